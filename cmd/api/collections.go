@@ -0,0 +1,405 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+var collectionSortSafeList = []string{
+	"id",
+	"name",
+	"created_at",
+	"last_modified",
+	"-id",
+	"-name",
+	"-created_at",
+	"-last_modified",
+}
+
+var collectionQuoteSortSafeList = []string{
+	"position",
+	"added_at",
+	"-position",
+	"-added_at",
+}
+
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	collection := &data.Collection{
+		UserID:      user.ID,
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		Visibility:  input.Visibility,
+	}
+
+	if collection.Visibility == "" {
+		collection.Visibility = data.VisibilityPublic
+	}
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Collections.Insert(collection)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/collections/%d", collection.ID))
+
+	err = app.writeJSON(w, envelope{"collection": collection}, http.StatusCreated, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getCollectionHandler returns the collection along with a page of the quotes in it
+func (app *application) getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamByName(r, "collection_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "position")
+	input.SortSafeList = collectionQuoteSortSafeList
+
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	collection, err := app.models.Collections.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	quotes, metadata, err := app.models.Quotes.GetAllInCollection(collection.ID, user.ID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"collection": collection, "quotes": quotes, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readUserIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "name")
+	input.SortSafeList = collectionSortSafeList
+
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	collections, metadata, err := app.models.Collections.GetAllForUser(userID, user.ID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"collections": collections, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOwnedCollection fetches the collection named by the collection_id parameter for handlers that
+// change it. It sends the error response itself and returns false if the collection doesn't exist
+// or doesn't belong to the authenticated user.
+func (app *application) readOwnedCollection(w http.ResponseWriter, r *http.Request) (*data.Collection, bool) {
+	id, err := app.readParamByName(r, "collection_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+
+	collection, err := app.models.Collections.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if collection.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return collection, true
+}
+
+func (app *application) updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		collection.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		collection.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Visibility != nil {
+		collection.Visibility = *input.Visibility
+	}
+
+	v := validator.New()
+	if data.ValidateCollection(v, collection); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Collections.Update(collection)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"collection": collection}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Collections.Delete(collection.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "collection successfully deleted"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addCollectionQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		QuoteID int64 `json:"quote_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.QuoteID > 0, "quote_id", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// only quotes the owner can see may be added, otherwise collections could be used to probe for
+	// other users' private quotes
+	_, err = app.models.Quotes.Get(input.QuoteID, collection.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("quote_id", "must refer to an existing quote")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Collections.AddQuote(collection.ID, input.QuoteID)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "quote successfully added to collection"}, http.StatusCreated, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// moveCollectionQuoteHandler changes the position of a quote within the collection
+func (app *application) moveCollectionQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	quoteID, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Position int `json:"position"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Position > 0, "position", "must be greater than zero")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Collections.MoveQuote(collection.ID, quoteID, input.Position)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "quote successfully moved"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeCollectionQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := app.readOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	quoteID, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Collections.RemoveQuote(collection.ID, quoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "quote successfully removed from collection"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+)
+
+func TestCollectionQuoteHandlers(t *testing.T) {
+	app, db := newTestApp(t)
+
+	owner := insertTestUser(t, db)
+	other := insertTestUser(t, db)
+
+	collection := &data.Collection{UserID: owner.ID, Name: "favourites", Visibility: data.VisibilityPublic}
+	err := app.models.Collections.Insert(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectionID := strconv.FormatInt(collection.ID, 10)
+
+	quote := insertTestQuote(t, db, &data.Quote{UserID: other.ID})
+	private := insertTestQuote(t, db, &data.Quote{UserID: other.ID, Visibility: data.VisibilityPrivate})
+
+	add := func(user *data.User, quoteID int64) int {
+		code, _ := serveAs(t, app, app.addCollectionQuoteHandler, user, http.MethodPost, "/", fmt.Sprintf(`{"quote_id": %d}`, quoteID), "collection_id", collectionID)
+		return code
+	}
+
+	assert.Equal(t, add(owner, quote.ID), http.StatusCreated)
+	assert.Equal(t, add(owner, quote.ID), http.StatusConflict)
+	// other users' private quotes can't be added, nor can anyone add to someone else's collection
+	assert.Equal(t, add(owner, private.ID), http.StatusUnprocessableEntity)
+	assert.Equal(t, add(other, private.ID), http.StatusForbidden)
+
+	quoteID := strconv.FormatInt(quote.ID, 10)
+
+	code, _ := serveAs(t, app, app.moveCollectionQuoteHandler, owner, http.MethodPatch, "/", `{"position": 0}`, "collection_id", collectionID, "quote_id", quoteID)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	code, _ = serveAs(t, app, app.moveCollectionQuoteHandler, owner, http.MethodPatch, "/", `{"position": 5}`, "collection_id", collectionID, "quote_id", quoteID)
+	assert.Equal(t, code, http.StatusOK)
+
+	code, _ = serveAs(t, app, app.removeCollectionQuoteHandler, owner, http.MethodDelete, "/", "", "collection_id", collectionID, "quote_id", quoteID)
+	assert.Equal(t, code, http.StatusOK)
+
+	code, _ = serveAs(t, app, app.removeCollectionQuoteHandler, owner, http.MethodDelete, "/", "", "collection_id", collectionID, "quote_id", quoteID)
+	assert.Equal(t, code, http.StatusNotFound)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+var commentSortSafeList = []string{
+	"created_at",
+	"-created_at",
+}
+
+// readViewableQuote fetches the quote named by the quote_id parameter if the authenticated user can
+// see it, sending the error response itself and returning false if not
+func (app *application) readViewableQuote(w http.ResponseWriter, r *http.Request) (*data.Quote, bool) {
+	quoteID, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return app.getViewableQuote(w, r, quoteID)
+}
+
+// getViewableQuote fetches the quote if the authenticated user can see it, sending the error
+// response itself and returning false if not
+func (app *application) getViewableQuote(w http.ResponseWriter, r *http.Request, quoteID int64) (*data.Quote, bool) {
+	user := app.contextGetUser(r)
+
+	quote, err := app.models.Quotes.Get(quoteID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return quote, true
+}
+
+func (app *application) listQuoteCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	quote, ok := app.readViewableQuote(w, r)
+	if !ok {
+		return
+	}
+
+	var input data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-created_at")
+	input.SortSafeList = commentSortSafeList
+
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, metadata, err := app.models.Comments.GetAllForQuote(quote.ID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"comments": comments, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	quote, ok := app.readViewableQuote(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body     string `json:"body"`
+		ParentID *int64 `json:"parent_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	comment := &data.Comment{
+		QuoteID:  quote.ID,
+		UserID:   user.ID,
+		ParentID: input.ParentID,
+		Body:     input.Body,
+	}
+
+	data.NormaliseComment(comment)
+
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Comments.Insert(comment)
+		if err != nil {
+			return err
+		}
+
+		return app.queueCommentNotification(tx, quote, comment)
+	})
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrInvalidParent):
+			v.AddError("parent_id", "must refer to a top-level comment on the same quote")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"comment": comment}, http.StatusCreated, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readComment fetches the comment named by the comment_id parameter, sending the error response
+// itself and returning false if it doesn't exist
+func (app *application) readComment(w http.ResponseWriter, r *http.Request) (*data.Comment, bool) {
+	id, err := app.readParamByName(r, "comment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	comment, err := app.models.Comments.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return comment, true
+}
+
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+
+	// comments can't be edited once the quote they're on is hidden from their author
+	_, ok = app.getViewableQuote(w, r, comment.QuoteID)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if comment.UserID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment.Body = input.Body
+	data.NormaliseComment(comment)
+
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Comments.Update(comment)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"comment": comment}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCommentHandler lets users delete their own comments and moderators with the quotes:admin
+// permission delete anyone's. Replies to the comment are deleted with it.
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, ok := app.readComment(w, r)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if comment.UserID != user.ID {
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !user.Activated || !permissions.Include("quotes:admin") {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	err := app.models.Comments.Delete(comment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "comment successfully deleted"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
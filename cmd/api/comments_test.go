@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+)
+
+func TestCommentHandlers(t *testing.T) {
+	app, db := newTestApp(t)
+
+	author := insertTestUser(t, db)
+	commenter := insertTestUser(t, db)
+	moderator := insertTestUser(t, db)
+
+	err := app.models.Permissions.AddForUser(moderator.ID, "quotes:admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quote := insertTestQuote(t, db, &data.Quote{UserID: author.ID})
+	quoteID := strconv.FormatInt(quote.ID, 10)
+
+	create := func(body string) (int, *data.Comment) {
+		code, resp := serveAs(t, app, app.createCommentHandler, commenter, http.MethodPost, "/", body, "quote_id", quoteID)
+
+		var output struct {
+			Comment *data.Comment `json:"comment"`
+		}
+		if code == http.StatusCreated {
+			err := json.Unmarshal([]byte(resp), &output)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return code, output.Comment
+	}
+
+	code, parent := create(`{"body": "parent"}`)
+	assert.Equal(t, code, http.StatusCreated)
+
+	code, reply := create(fmt.Sprintf(`{"body": "reply", "parent_id": %d}`, parent.ID))
+	assert.Equal(t, code, http.StatusCreated)
+	assert.Equal(t, *reply.ParentID, parent.ID)
+
+	code, _ = create(fmt.Sprintf(`{"body": "nested", "parent_id": %d}`, reply.ID))
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+
+	parentID := strconv.FormatInt(parent.ID, 10)
+
+	t.Run("Update on a hidden quote", func(t *testing.T) {
+		_, err := db.Exec("UPDATE quotes SET visibility = 'private' WHERE id = $1", quote.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Exec("UPDATE quotes SET visibility = 'public' WHERE id = $1", quote.ID)
+
+		code, _ := serveAs(t, app, app.updateCommentHandler, commenter, http.MethodPatch, "/", `{"body": "edited"}`, "comment_id", parentID)
+		assert.Equal(t, code, http.StatusNotFound)
+	})
+
+	code, _ = serveAs(t, app, app.updateCommentHandler, author, http.MethodPatch, "/", `{"body": "edited"}`, "comment_id", parentID)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, _ = serveAs(t, app, app.updateCommentHandler, commenter, http.MethodPatch, "/", `{"body": "edited"}`, "comment_id", parentID)
+	assert.Equal(t, code, http.StatusOK)
+
+	code, _ = serveAs(t, app, app.deleteCommentHandler, author, http.MethodDelete, "/", "", "comment_id", parentID)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	code, _ = serveAs(t, app, app.deleteCommentHandler, moderator, http.MethodDelete, "/", "", "comment_id", parentID)
+	assert.Equal(t, code, http.StatusOK)
+
+	// the reply went with its parent
+	_, err = app.models.Comments.Get(reply.ID)
+	assert.Equal(t, err, data.ErrRecordNotFound)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/mailer"
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// emailPreviewData is the sample data each email template is rendered with by the preview endpoint.
+// Every template needs an entry.
+var emailPreviewData = map[string]map[string]interface{}{
+	"digest": {
+		"username":  "alice",
+		"frequency": data.DigestWeekly,
+		"tags":      []string{"courage", "life"},
+		"quotes": []*data.Quote{
+			{Content: "Courage is grace under pressure.", Author: "Ernest Hemingway", Likes: 12},
+			{Content: "Life is what happens when you're busy making other plans.", Author: "John Lennon", Likes: 7},
+		},
+		"unsubscribeURL": "http://localhost:4000/v1/digest/unsubscribe?token=ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	},
+	"saved_search_match": {
+		"username":   "alice",
+		"searchID":   3,
+		"searchName": "Stoics on courage",
+		"quoteID":    7,
+		"content":    "The impediment to action advances action. What stands in the way becomes the way.",
+		"author":     "Marcus Aurelius",
+	},
+	"user_welcome": {
+		"userID":          42,
+		"username":        "alice",
+		"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	},
+}
+
+// previewEmailHandler renders an email template with sample data so that it can be checked in a
+// browser. It's only routed in development.
+func (app *application) previewEmailHandler(w http.ResponseWriter, r *http.Request) {
+	name := httprouter.ParamsFromContext(r.Context()).ByName("template")
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	locale := data.NormaliseLocale(app.readString(qs, "locale", ""))
+	format := app.readString(qs, "format", "html")
+
+	data.ValidateLocale(v, locale)
+	v.Check(validator.In(format, "html", "text"), "format", "must be html or text")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	msg, err := app.templates.Render(name, locale, emailPreviewData[name])
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrUnknownTemplate):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	switch format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(msg.HTMLBody))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Subject: %s\n%s", msg.Subject, msg.PlainBody)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+func TestEveryEmailTemplateHasPreviewData(t *testing.T) {
+	app := mockApp()
+
+	for _, name := range app.templates.Names() {
+		_, ok := emailPreviewData[name]
+		assert.Equal(t, ok, true)
+	}
+}
+
+func TestPreviewEmailHandler(t *testing.T) {
+	app := mockApp()
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"html", "/debug/emails/user_welcome", http.StatusOK, "<p>Dear alice,</p>"},
+		{"text", "/debug/emails/user_welcome?format=text", http.StatusOK, "Subject: Welcome to Quotable!"},
+		{"translated", "/debug/emails/user_welcome?locale=fr-FR&format=text", http.StatusOK, "Subject: Bienvenue sur Quotable !"},
+		{"unknown template", "/debug/emails/missing", http.StatusNotFound, ""},
+		{"invalid format", "/debug/emails/user_welcome?format=pdf", http.StatusUnprocessableEntity, "must be html or text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, body := ts.get(t, tt.urlPath)
+
+			assert.Equal(t, code, tt.wantCode)
+			if tt.wantBody != "" {
+				assert.StringContains(t, body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPreviewEmailHandlerOnlyInDevelopment(t *testing.T) {
+	app := mockApp()
+	app.config.env = "production"
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+
+	code, _, _ := ts.get(t, "/debug/emails/user_welcome")
+	assert.Equal(t, code, http.StatusNotFound)
+}
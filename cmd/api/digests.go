@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/mailer"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+const (
+	// how many users' digests are queued per transaction
+	digestBatchSize = 100
+	// how many quotes a digest contains
+	digestQuoteLimit = 5
+	// unsubscribe links have to keep working for a while after the email is sent
+	unsubscribeTokenTTL = 30 * 24 * time.Hour
+)
+
+type sendDigestJob struct {
+	UserID int64     `json:"user_id"`
+	Since  time.Time `json:"since"`
+}
+
+// queueDigests queues a job for every digest that is due and schedules the next one. Each batch
+// is claimed and queued in one transaction, so a digest is never queued twice or skipped.
+func (app *application) queueDigests() error {
+	for {
+		var queued int
+
+		err := app.models.Transaction(func(tx data.Models) error {
+			due, err := tx.Digests.ClaimDue(digestBatchSize)
+			if err != nil {
+				return err
+			}
+			queued = len(due)
+
+			now := time.Now()
+			for _, preferences := range due {
+				since := now.Add(-data.DigestPeriod(preferences.Frequency))
+				if preferences.LastSentAt != nil {
+					since = *preferences.LastSentAt
+				}
+
+				err = app.enqueueJob(tx, jobSendDigest, sendDigestJob{UserID: preferences.UserID, Since: since})
+				if err != nil {
+					return err
+				}
+
+				// the time zone was valid when it was stored
+				location, err := time.LoadLocation(preferences.Timezone)
+				if err != nil {
+					return err
+				}
+
+				err = tx.Digests.MarkQueued(preferences.UserID, data.NextDigestTime(now, preferences.Frequency, location))
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if queued < digestBatchSize {
+			return nil
+		}
+	}
+}
+
+// runSendDigestJob emails the user the most popular quotes since their last digest. Nothing is
+// sent if there weren't any, or if the user has turned digests off since the job was queued.
+func (app *application) runSendDigestJob(payload json.RawMessage) error {
+	var job sendDigestJob
+	err := decodeJobPayload(payload, &job)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.models.Users.Get(job.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	preferences, err := app.models.Digests.GetPreferences(user.ID)
+	if err != nil {
+		return err
+	}
+
+	if !preferences.Enabled || !user.Activated {
+		return nil
+	}
+
+	quotes, err := app.models.Quotes.GetTopSince(job.Since, preferences.Tags, digestQuoteLimit)
+	if err != nil {
+		return err
+	}
+
+	if len(quotes) == 0 {
+		return nil
+	}
+
+	token, err := app.models.Tokens.New(user.ID, unsubscribeTokenTTL, data.ScopeUnsubscribe)
+	if err != nil {
+		return err
+	}
+
+	unsubscribeURL := app.unsubscribeURL(token.Plaintext)
+
+	// mail clients that support one-click unsubscribe (RFC 8058) POST to the List-Unsubscribe URL
+	// themselves, everyone else follows the link to the confirmation page
+	headers := []mailer.Header{
+		{Name: "List-Unsubscribe", Value: "<" + unsubscribeURL + ">"},
+		{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+	}
+
+	err = app.mailer.Send(user.Email, user.Locale, "digest", map[string]interface{}{
+		"username":       user.Username,
+		"frequency":      preferences.Frequency,
+		"tags":           preferences.Tags,
+		"quotes":         quotes,
+		"unsubscribeURL": unsubscribeURL,
+	}, headers...)
+	if err != nil {
+		// the token never reached the user, so a retry shouldn't leave it behind next to its own
+		if deleteErr := app.models.Tokens.Delete(token); deleteErr != nil {
+			app.logger.Error().Err(deleteErr).Int64("user_id", user.ID).Msg("failed to delete unsent unsubscribe token")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// unsubscribeURL shows the unsubscribe confirmation page when followed from a digest email and
+// unsubscribes straight away when POSTed to
+func (app *application) unsubscribeURL(token string) string {
+	return fmt.Sprintf("%s/v1/digest/unsubscribe?token=%s", app.config.baseURL, url.QueryEscape(token))
+}
+
+func (app *application) getDigestPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	preferences, err := app.models.Digests.GetPreferences(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"digest": preferences}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateDigestPreferencesHandler changes the digest settings, fields left out of the request keep
+// their current value. Changing the frequency or time zone reschedules the next digest.
+func (app *application) updateDigestPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Enabled   *bool    `json:"enabled"`
+		Tags      []string `json:"tags"`
+		Frequency *string  `json:"frequency"`
+		Timezone  *string  `json:"timezone"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	preferences, err := app.models.Digests.GetPreferences(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if input.Enabled != nil {
+		preferences.Enabled = *input.Enabled
+	}
+	if input.Tags != nil {
+		preferences.Tags = input.Tags
+	}
+	if input.Frequency != nil {
+		preferences.Frequency = *input.Frequency
+	}
+	if input.Timezone != nil {
+		preferences.Timezone = *input.Timezone
+	}
+
+	data.NormaliseDigestPreferences(preferences)
+
+	v := validator.New()
+	if data.ValidateDigestPreferences(v, preferences); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Digests.SetPreferences(preferences)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"digest": preferences}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unsubscribePage asks for confirmation before unsubscribing, since links in emails are opened by
+// link scanners and prefetchers as well as by people
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Unsubscribe from Quotable digests</title>
+</head>
+<body>
+    <p>Do you want to stop receiving Quotable digest emails?</p>
+    <form method="POST" action="{{.}}">
+        <button type="submit">Unsubscribe</button>
+    </form>
+</body>
+</html>
+`))
+
+// unsubscribeDigestPageHandler serves the page digest emails link to, which POSTs the token to
+// unsubscribeDigestHandler once the user confirms
+func (app *application) unsubscribeDigestPageHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err := unsubscribePage.Execute(w, app.unsubscribeURL(token))
+	if err != nil {
+		app.logger.Error().Err(err).Msg("failed to render the unsubscribe page")
+	}
+}
+
+// unsubscribeDigestHandler turns off digests for the owner of the token from the email. It
+// doesn't need authentication so that it works in one click, including the RFC 8058 one-click
+// unsubscribe POSTed by mail clients, whose body is ignored.
+func (app *application) unsubscribeDigestHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeUnsubscribe, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unsubscribe token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Digests.Disable(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "you will no longer receive digest emails"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
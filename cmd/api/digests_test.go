@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/mailer"
+)
+
+// failingMailer fails to send every email, as an unreachable SMTP server would
+type failingMailer struct{}
+
+func (failingMailer) Send(recipient, locale, templateName string, data interface{}, headers ...mailer.Header) error {
+	return errors.New("connection refused")
+}
+
+// unsubscribeTokens counts the user's unsubscribe tokens
+func unsubscribeTokens(t *testing.T, db *sql.DB, userID int64) int {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT count(*) FROM tokens WHERE user_id = $1 AND scope = $2", userID, data.ScopeUnsubscribe).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestUnsubscribeDigestPage(t *testing.T) {
+	app := mockApp()
+	app.config.baseURL = "https://quotable.example"
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+
+	const token = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	// following the link from the email only shows the form, it doesn't unsubscribe anyone
+	code, header, body := ts.get(t, "/v1/digest/unsubscribe?token="+token)
+	assert.Equal(t, code, http.StatusOK)
+	assert.StringContains(t, header.Get("Content-Type"), "text/html")
+	assert.StringContains(t, body, `<form method="POST" action="https://quotable.example/v1/digest/unsubscribe?token=`+token+`">`)
+
+	code, _, body = ts.get(t, "/v1/digest/unsubscribe?token=short")
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.StringContains(t, body, "must be 26 bytes long")
+}
+
+func TestRunSendDigestJob(t *testing.T) {
+	app, db := newTestApp(t)
+	app.config.baseURL = "https://quotable.example"
+
+	user := insertTestUser(t, db)
+	liker := insertTestUser(t, db)
+
+	tag := fmt.Sprintf("digest-%d", time.Now().UnixNano())
+	quote := insertTestQuote(t, db, &data.Quote{UserID: liker.ID, Tags: []string{tag}})
+
+	_, err := app.models.Like.SetReaction(data.Like{UserID: liker.ID, QuoteID: quote.ID, Val: data.LikeValue})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.models.Digests.SetPreferences(&data.DigestPreferences{
+		UserID:    user.ID,
+		Enabled:   true,
+		Tags:      []string{tag},
+		Frequency: data.DigestDaily,
+		Timezone:  "UTC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(sendDigestJob{UserID: user.ID, Since: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed send doesn't leave behind a token nobody received
+	app.mailer = failingMailer{}
+	err = app.runJob(&data.Job{Type: jobSendDigest, Payload: payload})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assert.Equal(t, unsubscribeTokens(t, db, user.ID), 0)
+
+	capture := mailer.NewCapture(app.templates, "Quotable <no-reply@quotable.net>")
+	app.mailer = capture
+
+	err = app.runJob(&data.Job{Type: jobSendDigest, Payload: payload})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, unsubscribeTokens(t, db, user.ID), 1)
+
+	messages := capture.Messages()
+	assert.Equal(t, len(messages), 1)
+
+	headers := make(map[string]string)
+	for _, header := range messages[0].Headers {
+		headers[header.Name] = header.Value
+	}
+	assert.StringContains(t, headers["List-Unsubscribe"], "<https://quotable.example/v1/digest/unsubscribe?token=")
+	assert.Equal(t, headers["List-Unsubscribe-Post"], "List-Unsubscribe=One-Click")
+	assert.StringContains(t, messages[0].PlainBody, "https://quotable.example/v1/digest/unsubscribe?token=")
+}
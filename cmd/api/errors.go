@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/WanderingAura/quotable/internal/data"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -82,3 +85,27 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to be access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) duplicateQuoteResponse(w http.ResponseWriter, r *http.Request, existingID int64) {
+	message := envelope{
+		"message":           "an equivalent quote already exists, set allow_duplicate to create it anyway",
+		"existing_quote_id": existingID,
+	}
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// responds to a write that was rejected by a database constraint. Duplicates are reported as a
+// conflict and any other violation as a validation failure of the field the constraint applies to.
+func (app *application) constraintViolationResponse(w http.ResponseWriter, r *http.Request, err *data.ConstraintError) {
+	status := http.StatusUnprocessableEntity
+	if errors.Is(err, data.ErrDuplicate) {
+		status = http.StatusConflict
+	}
+
+	if err.Field == "" {
+		app.errorResponse(w, r, status, err.Message)
+		return
+	}
+
+	app.errorResponse(w, r, status, map[string]string{err.Field: err.Message})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+var followSortSafeList = []string{
+	"followed_at",
+	"-followed_at",
+}
+
+func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := app.readParamByName(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Follows.Insert(user.ID, followeeID)
+		if err != nil {
+			return err
+		}
+
+		return app.queueNotification(tx, data.Notification{
+			UserID:  followeeID,
+			ActorID: user.ID,
+			Type:    data.NotificationFollow,
+		})
+	})
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrForeignKeyViolation):
+			app.notFoundResponse(w, r)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "user successfully followed"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	followeeID, err := app.readParamByName(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Follows.Delete(user.ID, followeeID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "user successfully unfollowed"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// reads the pagination parameters shared by the follower and following lists
+func (app *application) readFollowFilters(r *http.Request, v *validator.Validator) data.Filters {
+	var input data.Filters
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-followed_at")
+	input.SortSafeList = followSortSafeList
+
+	data.ValidateFilters(v, input)
+
+	return input
+}
+
+func (app *application) listFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readUserIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	input := app.readFollowFilters(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	followers, metadata, err := app.models.Follows.GetFollowers(userID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"followers": followers, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readUserIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	input := app.readFollowFilters(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	following, metadata, err := app.models.Follows.GetFollowing(userID, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"following": following, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// feedHandler returns the most recent quotes from the users the authenticated user follows. It is
+// paginated with the opaque next_cursor from the previous page rather than page numbers so that
+// new quotes don't shift the pages while a client is scrolling.
+func (app *application) feedHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	pageSize := app.readInt(qs, "page_size", 20, v)
+	v.Check(pageSize > 0, "page_size", "must be greater than zero")
+	v.Check(pageSize <= 100, "page_size", "must be a max of 100")
+
+	var after *data.FeedCursor
+	if s := app.readString(qs, "cursor", ""); s != "" {
+		cursor, err := data.DecodeFeedCursor(s)
+		if err != nil {
+			v.AddError("cursor", "must be a cursor returned by a previous page")
+		}
+		after = &cursor
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	quotes, next, err := app.models.Quotes.GetFeed(user.ID, after, pageSize)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var nextCursor string
+	if next != nil {
+		nextCursor = next.Encode()
+	}
+
+	err = app.writeJSON(w, envelope{"quotes": quotes, "next_cursor": nextCursor}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
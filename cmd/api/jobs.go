@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/data"
+)
+
+// The types of job the workers know how to run
+const (
+	jobSendEmail          = "send_email"
+	jobSendWelcomeEmail   = "send_welcome_email"
+	jobCreateNotification = "create_notification"
+	jobQueueWebhookEvent  = "queue_webhook_event"
+	jobSendDigest         = "send_digest"
+	jobMatchSavedSearches = "match_saved_searches"
+)
+
+const (
+	jobBaseBackoff = 10 * time.Second
+	jobMaxBackoff  = time.Hour
+)
+
+// errJobPermanent is wrapped by job errors that retrying won't fix, the job is marked dead straight
+// away instead of using up its attempts
+var errJobPermanent = errors.New("permanent job failure")
+
+type jobType struct {
+	run         func(payload json.RawMessage) error
+	maxAttempts int
+}
+
+// jobTypes maps each type of job to the function that runs it
+func (app *application) jobTypes() map[string]jobType {
+	return map[string]jobType{
+		jobSendEmail:          {run: app.runSendEmailJob, maxAttempts: 10},
+		jobSendWelcomeEmail:   {run: app.runSendWelcomeEmailJob, maxAttempts: 10},
+		jobCreateNotification: {run: app.runCreateNotificationJob, maxAttempts: 5},
+		jobQueueWebhookEvent:  {run: app.runQueueWebhookEventJob, maxAttempts: 5},
+		jobSendDigest:         {run: app.runSendDigestJob, maxAttempts: 5},
+		jobMatchSavedSearches: {run: app.runMatchSavedSearchesJob, maxAttempts: 5},
+	}
+}
+
+type sendEmailJob struct {
+	Recipient string                 `json:"recipient"`
+	Locale    string                 `json:"locale,omitempty"`
+	Template  string                 `json:"template"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+type createNotificationJob struct {
+	UserID    int64  `json:"user_id"`
+	ActorID   int64  `json:"actor_id"`
+	Type      string `json:"type"`
+	QuoteID   *int64 `json:"quote_id,omitempty"`
+	CommentID *int64 `json:"comment_id,omitempty"`
+}
+
+type queueWebhookEventJob struct {
+	Event   string          `json:"event"`
+	OwnerID int64           `json:"owner_id"`
+	Listed  bool            `json:"listed"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// enqueueJob stores a job for the workers to run as soon as one of them is free. Passing the models
+// of a transaction means the job only runs if the transaction is committed.
+func (app *application) enqueueJob(models data.Models, jobType string, payload interface{}) error {
+	return app.scheduleJob(models, jobType, payload, time.Now())
+}
+
+// scheduleJob stores a job for the workers to run once runAt has passed
+func (app *application) scheduleJob(models data.Models, jobType string, payload interface{}, runAt time.Time) error {
+	t, ok := app.jobTypes()[jobType]
+	if !ok {
+		return fmt.Errorf("unknown job type %q", jobType)
+	}
+
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return models.Jobs.Insert(&data.Job{
+		Type:        jobType,
+		Payload:     js,
+		MaxAttempts: t.maxAttempts,
+		RunAt:       runAt,
+	})
+}
+
+// startJobWorkers starts the worker pool. Each worker finishes the job it is running and returns
+// once stop is closed, so queued jobs are picked up again after a restart rather than lost.
+func (app *application) startJobWorkers(stop <-chan struct{}) {
+	for i := 0; i < app.config.jobs.workers; i++ {
+		app.background(func() {
+			app.runJobWorker(stop)
+		})
+	}
+}
+
+func (app *application) runJobWorker(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		ran, err := app.runNextJob()
+		if err != nil {
+			app.logger.Error().Err(err).Msg("job worker failed")
+		}
+
+		// keep going while there is work, otherwise wait for more to come in
+		if ran && err == nil {
+			continue
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(app.config.jobs.pollInterval):
+		}
+	}
+}
+
+// runNextJob claims and runs the next due job. It returns false if there was nothing to run.
+func (app *application) runNextJob() (bool, error) {
+	job, err := app.models.Jobs.Claim(app.config.jobs.lease)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	jobErr := app.runJob(job)
+	if jobErr == nil {
+		err = app.models.Jobs.Complete(job)
+	} else {
+		var retryAt *time.Time
+		if job.Attempts < job.MaxAttempts && !errors.Is(jobErr, errJobPermanent) {
+			next := time.Now().Add(jobBackoff(job.Attempts))
+			retryAt = &next
+		}
+
+		logEvent := app.logger.Warn()
+		if retryAt == nil {
+			logEvent = app.logger.Error()
+		}
+		logEvent.Err(jobErr).Int64("job_id", job.ID).Str("type", job.Type).Int("attempts", job.Attempts).Bool("dead", retryAt == nil).Msg("job failed")
+
+		err = app.models.Jobs.Fail(job, jobErr, retryAt)
+	}
+
+	// the job ran past its lease and may have been claimed by another worker, whose outcome counts
+	if errors.Is(err, data.ErrLeaseExpired) {
+		app.logger.Warn().Int64("job_id", job.ID).Str("type", job.Type).Msg("job finished after its lease expired")
+		return true, nil
+	}
+
+	return true, err
+}
+
+// runJob runs the job, turning a panic into an error so the job is retried like any other failure
+func (app *application) runJob(job *data.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	t, ok := app.jobTypes()[job.Type]
+	if !ok {
+		return fmt.Errorf("%w: unknown job type %q", errJobPermanent, job.Type)
+	}
+
+	return t.run(job.Payload)
+}
+
+// jobBackoff returns how long to wait before retrying a job that has failed the given number of
+// times. It doubles with every failure starting from 10 seconds and is capped at an hour.
+func jobBackoff(failures int) time.Duration {
+	backoff := jobBaseBackoff
+	for i := 1; i < failures; i++ {
+		backoff *= 2
+		if backoff >= jobMaxBackoff {
+			return jobMaxBackoff
+		}
+	}
+
+	return backoff
+}
+
+// decodeJobPayload decodes numbers as json.Number so that IDs put in email templates aren't turned
+// into floats
+func decodeJobPayload(payload json.RawMessage, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		return fmt.Errorf("%w: invalid payload: %v", errJobPermanent, err)
+	}
+
+	return nil
+}
+
+func (app *application) runSendEmailJob(payload json.RawMessage) error {
+	var job sendEmailJob
+	err := decodeJobPayload(payload, &job)
+	if err != nil {
+		return err
+	}
+
+	return app.mailer.Send(job.Recipient, job.Locale, job.Template, job.Data)
+}
+
+func (app *application) runCreateNotificationJob(payload json.RawMessage) error {
+	var job createNotificationJob
+	err := decodeJobPayload(payload, &job)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Notifications.Insert(&data.Notification{
+		UserID:    job.UserID,
+		ActorID:   job.ActorID,
+		Type:      job.Type,
+		QuoteID:   job.QuoteID,
+		CommentID: job.CommentID,
+	})
+
+	// the quote or comment was deleted before the job ran, so there's nothing to notify about
+	var constraintErr *data.ConstraintError
+	if errors.As(err, &constraintErr) {
+		return fmt.Errorf("%w: %v", errJobPermanent, err)
+	}
+
+	return err
+}
+
+func (app *application) runQueueWebhookEventJob(payload json.RawMessage) error {
+	var job queueWebhookEventJob
+	err := decodeJobPayload(payload, &job)
+	if err != nil {
+		return err
+	}
+
+	return app.models.Webhooks.Enqueue(job.Event, job.OwnerID, job.Listed, job.Payload)
+}
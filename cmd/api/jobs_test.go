@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/mailer"
+)
+
+func TestJobBackoff(t *testing.T) {
+	assert.Equal(t, jobBackoff(1), 10*time.Second)
+	assert.Equal(t, jobBackoff(2), 20*time.Second)
+	assert.Equal(t, jobBackoff(4), 80*time.Second)
+	assert.Equal(t, jobBackoff(20), time.Hour)
+}
+
+func TestRunJobPermanentFailures(t *testing.T) {
+	app := mockApp()
+
+	tests := []struct {
+		name string
+		job  *data.Job
+	}{
+		{
+			name: "unknown type",
+			job:  &data.Job{Type: "launch_rockets", Payload: json.RawMessage(`{}`)},
+		},
+		{
+			name: "invalid payload",
+			job:  &data.Job{Type: jobSendEmail, Payload: json.RawMessage(`{"recipient": 1}`)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := app.runJob(tt.job)
+			assert.Equal(t, errors.Is(err, errJobPermanent), true)
+		})
+	}
+}
+
+func TestDecodeJobPayloadKeepsIDs(t *testing.T) {
+	var job sendEmailJob
+	err := decodeJobPayload(json.RawMessage(`{"data": {"userID": 12345678}}`), &job)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, job.Data["userID"], interface{}(json.Number("12345678")))
+}
+
+func TestRunSendEmailJob(t *testing.T) {
+	app := mockApp()
+	capture := mailer.NewCapture(app.templates, "Quotable <no-reply@quotable.net>")
+	app.mailer = capture
+
+	err := app.runJob(&data.Job{
+		Type:    jobSendEmail,
+		Payload: json.RawMessage(`{"recipient": "alice@example.com", "locale": "fr", "template": "user_welcome", "data": {"userID": 12345678, "username": "alice", "activationToken": "TOKEN"}}`),
+	})
+	assert.Equal(t, err, nil)
+
+	messages := capture.Messages()
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].To, "alice@example.com")
+	assert.StringContains(t, messages[0].PlainBody, "votre numéro d'utilisateur est 12345678")
+}
+
+// activationTokens counts the user's activation tokens
+func activationTokens(t *testing.T, db *sql.DB, userID int64) int {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT count(*) FROM tokens WHERE user_id = $1 AND scope = $2", userID, data.ScopeActivation).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestRunSendWelcomeEmailJob(t *testing.T) {
+	app, db := newTestApp(t)
+	capture := mailer.NewCapture(app.templates, "Quotable <no-reply@quotable.net>")
+	app.mailer = capture
+
+	user := insertTestUser(t, db)
+	payload := json.RawMessage(fmt.Sprintf(`{"user_id": %d}`, user.ID))
+
+	// activated users don't need another token
+	err := app.runJob(&data.Job{Type: jobSendWelcomeEmail, Payload: payload})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(capture.Messages()), 0)
+
+	_, err = db.Exec("UPDATE users SET activated = false WHERE id = $1", user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a token that couldn't be sent isn't kept
+	app.mailer = failingMailer{}
+	err = app.runJob(&data.Job{Type: jobSendWelcomeEmail, Payload: payload})
+	assert.Equal(t, err != nil, true)
+	assert.Equal(t, activationTokens(t, db, user.ID), 0)
+
+	// and running the job again replaces the token sent before
+	app.mailer = capture
+	for i := 0; i < 2; i++ {
+		err = app.runJob(&data.Job{Type: jobSendWelcomeEmail, Payload: payload})
+		assert.Equal(t, err, nil)
+	}
+
+	messages := capture.Messages()
+	assert.Equal(t, len(messages), 2)
+	assert.Equal(t, messages[0].To, user.Email)
+	assert.Equal(t, activationTokens(t, db, user.ID), 1)
+}
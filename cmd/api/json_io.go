@@ -21,6 +21,20 @@ func (app *application) readParamByName(r *http.Request, name string) (int64, er
 	return id, nil
 }
 
+// reads a user ID route parameter where "me" stands for the authenticated user
+func (app *application) readUserIDParam(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+	if params.ByName(name) == "me" {
+		user := app.contextGetUser(r)
+		if user.IsAnonymous() {
+			return 0, errors.New("invalid ID parameter")
+		}
+		return user.ID, nil
+	}
+
+	return app.readParamByName(r, name)
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
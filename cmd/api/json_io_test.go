@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestReadUserIDParam(t *testing.T) {
+	app := mockApp()
+	user := &data.User{ID: 7}
+
+	tests := []struct {
+		name  string
+		value string
+		user  *data.User
+		id    int64
+		valid bool
+	}{
+		{name: "me", value: "me", user: user, id: 7, valid: true},
+		{name: "me when anonymous", value: "me", user: data.AnonymousUser, valid: false},
+		{name: "ID", value: "42", user: user, id: 42, valid: true},
+		{name: "ID when anonymous", value: "42", user: data.AnonymousUser, id: 42, valid: true},
+		{name: "zero", value: "0", user: user, valid: false},
+		{name: "not a number", value: "you", user: user, valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			params := httprouter.Params{{Key: "user_id", Value: test.value}}
+			r = app.contextSetUser(r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params)), test.user)
+
+			id, err := app.readUserIDParam(r, "user_id")
+			assert.Equal(t, err == nil, test.valid)
+			if test.valid {
+				assert.Equal(t, id, test.id)
+			}
+		})
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/WanderingAura/quotable/internal/data"
 	"github.com/WanderingAura/quotable/internal/mailer"
+	"github.com/WanderingAura/quotable/internal/webhook"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/pkgerrors"
 )
@@ -26,16 +27,20 @@ var (
 
 // Stores all the relevant info about the app (to be used by the handlers)
 type application struct {
-	config config
-	logger *zerolog.Logger
-	models data.Models    // Exposes CRUD operations on database tables
-	mailer mailer.Mailer  // Used for sending an email after user registration
-	wg     sync.WaitGroup // Used for graceful shutdown
+	config    config
+	logger    *zerolog.Logger
+	models    data.Models       // Exposes CRUD operations on database tables
+	mailer    mailer.Mailer     // Used for sending emails, the backend is chosen by config
+	templates *mailer.Templates // The email templates, parsed once on start up
+	webhooks  *webhook.Sender   // Used for delivering events to webhook endpoints
+	stream    *streamBroker     // Sends quote events to the clients of the event stream
+	wg        sync.WaitGroup    // Used for graceful shutdown
 }
 
 // Used to configure the various settings of the app on start up
 type config struct {
 	port    int
+	baseURL string
 	env     string
 	debug   bool
 	logPath string
@@ -50,6 +55,28 @@ type config struct {
 		burst   int
 		enabled bool
 	}
+	scheduler struct {
+		publishInterval       time.Duration
+		scoresRefreshInterval time.Duration
+		digestInterval        time.Duration
+	}
+	stream struct {
+		retention time.Duration
+	}
+	jobs struct {
+		workers      int
+		pollInterval time.Duration
+		lease        time.Duration
+	}
+	webhooks struct {
+		interval  time.Duration
+		batchSize int
+		timeout   time.Duration
+	}
+	mailer struct {
+		backend string
+		dir     string
+	}
 	smtp struct {
 		host     string
 		port     int
@@ -64,6 +91,7 @@ func main() {
 	var config config
 
 	flag.IntVar(&config.port, "port", 4000, "API server port")
+	flag.StringVar(&config.baseURL, "base-url", "http://localhost:4000", "Public URL of the API, used for links in emails")
 
 	flag.StringVar(&config.env, "env", "development", "Environment (development|staging|production)")
 	flag.BoolVar(&config.debug, "debug", false, "debug mode")
@@ -81,7 +109,27 @@ func main() {
 	flag.IntVar(&config.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&config.limiter.enabled, "limiter-enable", true, "Enable rate limiter")
 
+	// scheduler config
+	flag.DurationVar(&config.scheduler.publishInterval, "publish-interval", time.Minute, "How often to publish scheduled quotes that are due")
+	flag.DurationVar(&config.scheduler.scoresRefreshInterval, "scores-refresh-interval", 5*time.Minute, "How often to recompute the hot and top quote rankings")
+	flag.DurationVar(&config.scheduler.digestInterval, "digest-interval", 15*time.Minute, "How often to queue email digests that are due")
+
+	// event stream config
+	flag.DurationVar(&config.stream.retention, "stream-retention", time.Hour, "How long stream events are kept for clients resuming with Last-Event-ID")
+
+	// background job config
+	flag.IntVar(&config.jobs.workers, "job-workers", 4, "Number of background job workers")
+	flag.DurationVar(&config.jobs.pollInterval, "job-poll-interval", time.Second, "How often idle job workers check for due jobs")
+	flag.DurationVar(&config.jobs.lease, "job-lease", 5*time.Minute, "How long a job can run before another worker may take it over")
+
+	// webhook delivery config
+	flag.DurationVar(&config.webhooks.interval, "webhook-interval", 10*time.Second, "How often to send due webhook deliveries")
+	flag.IntVar(&config.webhooks.batchSize, "webhook-batch-size", 20, "Maximum number of webhook deliveries sent at once")
+	flag.DurationVar(&config.webhooks.timeout, "webhook-timeout", 10*time.Second, "Timeout for each webhook delivery request")
+
 	// mailer config
+	flag.StringVar(&config.mailer.backend, "mailer", "smtp", "Email backend (smtp|file|log)")
+	flag.StringVar(&config.mailer.dir, "mailer-dir", "./tmp/emails", "Directory the file email backend writes .eml files to")
 	flag.StringVar(&config.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&config.smtp.port, "smtp-port", 587, "SMTP port")
 	flag.StringVar(&config.smtp.username, "smtp-username", os.Getenv("QUOTABLE_SMTP_USERNAME"), "SMTP username")
@@ -89,6 +137,8 @@ func main() {
 	flag.StringVar(&config.smtp.sender, "smtp-sender", "Quotable <no-reply@quotable.net>", "SMTP sender")
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
+	reconcileReactionCounts := flag.Bool("reconcile-reaction-counts", false, "Recompute the like and dislike counters of every quote and exit")
+	refreshContentFingerprints := flag.Bool("refresh-content-fingerprints", false, "Recompute the duplicate detection fingerprint of every quote and exit")
 
 	flag.Parse()
 
@@ -111,17 +161,61 @@ func main() {
 	zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
 	logger := zerolog.New(logFile).With().Timestamp().Logger()
 
+	// the scheduler's tickers panic on intervals that aren't positive
+	intervals := map[string]time.Duration{
+		"publish-interval":        config.scheduler.publishInterval,
+		"scores-refresh-interval": config.scheduler.scoresRefreshInterval,
+		"digest-interval":         config.scheduler.digestInterval,
+		"webhook-interval":        config.webhooks.interval,
+	}
+	for name, interval := range intervals {
+		if interval <= 0 {
+			logger.Fatal().Str("flag", name).Dur("interval", interval).Msg("interval must be greater than zero")
+		}
+	}
+
 	db, err := openDB(config)
 	if err != nil {
 		logger.Fatal().Stack().Err(err).Msg("db connection failed")
 	}
 	logger.Info().Msg("database connection successful!")
 
+	if *reconcileReactionCounts {
+		reconciled, err := data.New(db).Like.ReconcileCounts()
+		if err != nil {
+			logger.Fatal().Stack().Err(err).Msg("reaction count reconciliation failed")
+		}
+		logger.Info().Int64("quotes", reconciled).Msg("reconciled reaction counts")
+		os.Exit(0)
+	}
+
+	if *refreshContentFingerprints {
+		models := data.New(db)
+		refreshed, err := models.Quotes.RefreshFingerprints()
+		if err != nil {
+			logger.Fatal().Stack().Err(err).Msg("content fingerprint refresh failed")
+		}
+		logger.Info().Int64("quotes", refreshed).Msg("refreshed content fingerprints")
+		os.Exit(0)
+	}
+
+	templates, err := mailer.LoadTemplates()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("email templates are invalid")
+	}
+
+	mail, err := newMailer(config, templates, &logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("mailer setup failed")
+	}
+
 	app := &application{
-		config: config,
-		logger: &logger,
-		models: data.New(db),
-		mailer: mailer.New(config.smtp.host, config.smtp.port, config.smtp.username, config.smtp.password, config.smtp.sender),
+		config:    config,
+		logger:    &logger,
+		models:    data.New(db),
+		mailer:    mail,
+		templates: templates,
+		webhooks:  webhook.New(config.webhooks.timeout),
 	}
 
 	err = app.serve()
@@ -130,6 +224,21 @@ func main() {
 	}
 }
 
+// Sets up the email backend chosen by the -mailer flag. The file and log backends let the app be
+// run without access to an SMTP server.
+func newMailer(config config, templates *mailer.Templates, logger *zerolog.Logger) (mailer.Mailer, error) {
+	switch config.mailer.backend {
+	case "smtp":
+		return mailer.NewSMTP(templates, config.smtp.host, config.smtp.port, config.smtp.username, config.smtp.password, config.smtp.sender), nil
+	case "file":
+		return mailer.NewFile(templates, config.mailer.dir, config.smtp.sender)
+	case "log":
+		return mailer.NewLog(templates, logger, config.smtp.sender), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer backend %q", config.mailer.backend)
+	}
+}
+
 // Sets up the postgres database connection
 func openDB(config config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", config.db.dsn)
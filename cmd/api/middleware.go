@@ -101,13 +101,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		token := headerParts[1]
 
-		v := validator.New()
-		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
-			app.invalidAuthenticationTokenResponse(w, r)
-			return
-		}
-
-		user, err := app.models.Users.GetForToken(data.ScopeAuth, token)
+		user, err := app.userForAuthToken(token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -124,6 +118,17 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// returns the user that the auth token belongs to, or data.ErrRecordNotFound if the token is
+// malformed, expired or doesn't exist
+func (app *application) userForAuthToken(token string) (*data.User, error) {
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return app.models.Users.GetForToken(data.ScopeAuth, token)
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+var noteSortSafeList = []string{
+	"relevance",
+	"created_at",
+	"last_modified",
+	"-created_at",
+	"-last_modified",
+}
+
+func (app *application) getNoteHandler(w http.ResponseWriter, r *http.Request) {
+	quote, ok := app.readViewableQuote(w, r)
+	if !ok {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	note, err := app.models.Notes.Get(user.ID, quote.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"note": note}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// setNoteHandler creates the user's note on the quote, or replaces it if they already have one.
+// Notes are private so any quote the user can see can be annotated, not just their own.
+func (app *application) setNoteHandler(w http.ResponseWriter, r *http.Request) {
+	quote, ok := app.readViewableQuote(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	note := &data.Note{
+		UserID:  user.ID,
+		QuoteID: quote.ID,
+		Body:    input.Body,
+	}
+
+	data.NormaliseNote(note)
+
+	v := validator.New()
+	if data.ValidateNote(v, note); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	created, err := app.models.Notes.Set(note)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		// the quote was deleted after it was fetched
+		case errors.Is(err, data.ErrForeignKeyViolation):
+			app.notFoundResponse(w, r)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, envelope{"note": note}, status, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteNoteHandler(w http.ResponseWriter, r *http.Request) {
+	quoteID, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Notes.Delete(user.ID, quoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "note successfully deleted"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listNotesHandler searches the full text of the user's notes with q. Matching notes are ranked by
+// relevance unless another sort is given, and without q every note is listed, newest first.
+func (app *application) listNotesHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	text := app.readString(qs, "q", "")
+
+	defaultSort := "-last_modified"
+	if text != "" {
+		defaultSort = "relevance"
+	}
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", defaultSort)
+	input.SortSafeList = noteSortSafeList
+
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	notes, metadata, err := app.models.Notes.Search(user.ID, text, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"notes": notes, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
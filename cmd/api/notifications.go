@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+var notificationSortSafeList = []string{
+	"created_at",
+	"-created_at",
+}
+
+// queueNotification queues a job to store the notification so that the request that caused it
+// doesn't wait on the extra write. Passing the models of the transaction that made the change
+// means the notification is only sent if the change is committed.
+func (app *application) queueNotification(models data.Models, notification data.Notification) error {
+	return app.enqueueJob(models, jobCreateNotification, createNotificationJob{
+		UserID:    notification.UserID,
+		ActorID:   notification.ActorID,
+		Type:      notification.Type,
+		QuoteID:   notification.QuoteID,
+		CommentID: notification.CommentID,
+	})
+}
+
+// queueCommentNotification notifies the quote's owner about a new comment, or the parent
+// comment's author about a reply
+func (app *application) queueCommentNotification(models data.Models, quote *data.Quote, comment *data.Comment) error {
+	notification := data.Notification{
+		UserID:    quote.UserID,
+		ActorID:   comment.UserID,
+		Type:      data.NotificationComment,
+		QuoteID:   &quote.ID,
+		CommentID: &comment.ID,
+	}
+
+	if comment.ParentID != nil {
+		parent, err := models.Comments.Get(*comment.ParentID)
+		if err != nil {
+			return err
+		}
+
+		notification.UserID = parent.UserID
+		notification.Type = data.NotificationReply
+	}
+
+	return app.queueNotification(models, notification)
+}
+
+func (app *application) listNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	unreadOnly := app.readBool(qs, "unread", false, v)
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-created_at")
+	input.SortSafeList = notificationSortSafeList
+
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	notifications, metadata, err := app.models.Notifications.GetAllForUser(user.ID, unreadOnly, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	unreadCount, err := app.models.Notifications.UnreadCount(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"notifications": notifications, "unread_count": unreadCount, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// markNotificationsReadHandler marks the notifications with the given IDs as read, or all of the
+// user's notifications if no IDs are given
+func (app *application) markNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.IDs) <= 100, "ids", "must not contain more than 100 IDs")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	marked, err := app.models.Notifications.MarkRead(user.ID, input.IDs)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	unreadCount, err := app.models.Notifications.UnreadCount(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"marked_read": marked, "unread_count": unreadCount}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	preferences, err := app.models.Notifications.GetPreferences(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"preferences": preferences}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateNotificationPreferencesHandler turns notification types on or off, types left out of the
+// request keep their current setting
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Preferences map[string]bool `json:"preferences"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Preferences) > 0, "preferences", "must be provided")
+	for notificationType := range input.Preferences {
+		v.Check(validator.In(notificationType, data.NotificationTypes...), "preferences", "must only contain reaction, comment, reply, follow or saved_search")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Notifications.SetPreferences(user.ID, input.Preferences)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	preferences, err := app.models.Notifications.GetPreferences(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"preferences": preferences}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
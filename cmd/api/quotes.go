@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/WanderingAura/quotable/internal/data"
 	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/julienschmidt/httprouter"
 )
 
 var quoteSortSafeList = []string{
@@ -20,6 +23,31 @@ var quoteSortSafeList = []string{
 	"-modified_at",
 	"-created_at",
 	"-user_id",
+	"hot",
+	"top_day",
+	"top_week",
+	"top_month",
+	"top_all",
+}
+
+var likedQuoteSortSafeList = []string{
+	"liked_at",
+	"-liked_at",
+}
+
+// the time windows that sort=top can rank quotes over
+var quoteTopWindows = []string{
+	"day",
+	"week",
+	"month",
+	"all",
+}
+
+var duplicateClusterSortSafeList = []string{
+	"size",
+	"first_id",
+	"-size",
+	"-first_id",
 }
 
 func (app *application) createQuoteHandler(w http.ResponseWriter, r *http.Request) {
@@ -32,6 +60,14 @@ func (app *application) createQuoteHandler(w http.ResponseWriter, r *http.Reques
 		Author  string      `json:"author,omitempty"`
 		Source  data.Source `json:"source,omitempty"`
 		Tags    []string    `json:"tags,omitempty"`
+		// one of public, unlisted or private. Defaults to public
+		Visibility string `json:"visibility,omitempty"`
+		// one of draft, scheduled or published. Defaults to scheduled if publish_at is set and
+		// published otherwise
+		Status    string     `json:"status,omitempty"`
+		PublishAt *time.Time `json:"publish_at,omitempty"`
+		// set to deliberately create a quote that matches an existing one
+		AllowDuplicate bool `json:"allow_duplicate,omitempty"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -45,25 +81,73 @@ func (app *application) createQuoteHandler(w http.ResponseWriter, r *http.Reques
 	// copying input vals into quote struct prevents user from
 	// inputing unwanted quote fields like Version and ID
 	quote := data.Quote{
-		UserID:  user.ID,
-		Content: input.Content,
-		Author:  input.Author,
-		Source:  input.Source,
-		Tags:    input.Tags,
+		UserID:     user.ID,
+		Content:    input.Content,
+		Author:     input.Author,
+		Source:     input.Source,
+		Tags:       input.Tags,
+		Visibility: input.Visibility,
+		Status:     input.Status,
+		PublishAt:  input.PublishAt,
 	}
+
+	if quote.Visibility == "" {
+		quote.Visibility = data.VisibilityPublic
+	}
+
+	if quote.Status == "" {
+		quote.Status = data.StatusPublished
+		if quote.PublishAt != nil {
+			quote.Status = data.StatusScheduled
+		}
+	}
+
+	data.NormaliseQuote(&quote)
+
 	// initialising validator inside of the handlers gives us
 	// flexibility when we have to have multiple validation checks
 	v := validator.New()
 	data.ValidateQuote(v, &quote)
+	data.ValidatePublishAt(v, &quote)
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Quotes.Insert(&quote)
+	if !input.AllowDuplicate {
+		existing, err := app.models.Quotes.FindDuplicate(quote.Content, user.ID, 0)
+		switch {
+		case err == nil:
+			app.duplicateQuoteResponse(w, r, existing.ID)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Quotes.Insert(&quote)
+		if err != nil {
+			return err
+		}
+
+		err = app.queueSavedSearchMatch(tx, &quote)
+		if err != nil {
+			return err
+		}
+
+		return app.queueCreatedEvent(tx, &quote)
+	})
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -77,14 +161,52 @@ func (app *application) createQuoteHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-func (app *application) getQuoteHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readParamByName(r, "quote_id")
+// httprouter doesn't let a fixed path segment share its position with a named parameter, so the
+// /v1/quotes/random and /v1/quotes/daily routes are dispatched on the value of :quote_id here
+func (app *application) dispatchQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	switch httprouter.ParamsFromContext(r.Context()).ByName("quote_id") {
+	case "random":
+		app.randomQuoteHandler(w, r)
+	case "daily":
+		app.dailyQuoteHandler(w, r)
+	default:
+		app.getQuoteHandler(w, r)
+	}
+}
+
+func (app *application) randomQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	search := app.readQuoteSearchCriteria(r.URL.Query())
+	user := app.contextGetUser(r)
+
+	quote, err := app.models.Quotes.GetRandom(user.ID, search)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	quote, err := app.models.Quotes.Get(id)
+	err = app.writeJSON(w, envelope{"quote": quote}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) dailyQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	location := app.readTimezone(r.URL.Query(), "tz", "UTC", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	today := time.Now().In(location)
+
+	quote, err := app.models.Quotes.GetDaily(today, location.String())
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -95,12 +217,51 @@ func (app *application) getQuoteHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	likeCount, err := app.models.Like.GetLikeDislikeNumForQuote(quote.ID)
+	env := envelope{
+		"quote":    quote,
+		"date":     today.Format(time.DateOnly),
+		"timezone": location.String(),
+	}
+
+	err = app.writeJSON(w, env, http.StatusOK, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
 
+	user := app.contextGetUser(r)
+
+	quote, err := app.models.Quotes.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !user.IsAnonymous() {
+		note, err := app.models.Notes.Get(user.ID, quote.ID)
+		switch {
+		case err == nil:
+			quote.MyNote = note
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	likeCount := data.LikeCount{LikeNum: quote.Likes, DislikeNum: quote.Dislikes}
+
 	err = app.writeJSON(w, envelope{"quote": quote, "like_count": likeCount}, http.StatusOK, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -108,20 +269,37 @@ func (app *application) getQuoteHandler(w http.ResponseWriter, r *http.Request)
 }
 
 type quoteSearchFields struct {
-	Content string
-	Tags    []string
+	data.QuoteSearch
 	data.Filters
 }
 
+// reads the content, author and tags search criteria from the query string
+func (app *application) readQuoteSearchCriteria(qs url.Values) data.QuoteSearch {
+	return data.QuoteSearch{
+		Content: app.readString(qs, "content", ""),
+		Author:  app.readString(qs, "author", ""),
+		Tags:    app.readCSV(qs, "tags", []string{}),
+	}
+}
+
 func (app *application) readQuoteSearch(r *http.Request, input *quoteSearchFields, v *validator.Validator) {
 	qs := r.URL.Query()
-	input.Content = app.readString(qs, "content", "")
-	input.Tags = app.readCSV(qs, "tags", []string{})
+	input.QuoteSearch = app.readQuoteSearchCriteria(qs)
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	input.Filters.SortSafeList = quoteSortSafeList
+
+	// sort=top ranks quotes over a time window, which maps to one of the top_<window> sorts
+	if input.Filters.Sort == "top" {
+		window := app.readString(qs, "window", "all")
+		if validator.In(window, quoteTopWindows...) {
+			input.Filters.Sort = "top_" + window
+		} else {
+			v.AddError("window", "must be one of day, week, month or all")
+		}
+	}
 }
 
 func (app *application) listQuotesHandler(w http.ResponseWriter, r *http.Request) {
@@ -135,7 +313,9 @@ func (app *application) listQuotesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	quotes, metadata, err := app.models.Quotes.GetAll(input.Content, input.Tags, input.Filters)
+	user := app.contextGetUser(r)
+
+	quotes, metadata, err := app.models.Quotes.GetAll(user.ID, input.QuoteSearch, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -149,7 +329,7 @@ func (app *application) listQuotesHandler(w http.ResponseWriter, r *http.Request
 }
 
 func (app *application) listUserQuotesHandler(w http.ResponseWriter, r *http.Request) {
-	userID, err := app.readParamByName(r, "user_id")
+	userID, err := app.readUserIDParam(r, "user_id")
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
@@ -163,7 +343,9 @@ func (app *application) listUserQuotesHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	quotes, metadata, err := app.models.Quotes.GetAllForUser(userID, input.Content, input.Tags, input.Filters)
+	user := app.contextGetUser(r)
+
+	quotes, metadata, err := app.models.Quotes.GetAllForUser(userID, user.ID, input.QuoteSearch, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -175,7 +357,7 @@ func (app *application) listUserQuotesHandler(w http.ResponseWriter, r *http.Req
 	}
 }
 
-func (app *application) deleteQuotesHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) updateQuoteHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readParamByName(r, "quote_id")
 	if err != nil {
 		app.notFoundResponse(w, r)
@@ -184,7 +366,7 @@ func (app *application) deleteQuotesHandler(w http.ResponseWriter, r *http.Reque
 
 	user := app.contextGetUser(r)
 
-	quote, err := app.models.Quotes.Get(id)
+	quote, err := app.models.Quotes.Get(id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -200,68 +382,243 @@ func (app *application) deleteQuotesHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Quotes.Delete(id)
+	// pointers let us tell fields that were left out of the request apart from zero values
+	var input struct {
+		Content    *string      `json:"content"`
+		Author     *string      `json:"author"`
+		Source     *data.Source `json:"source"`
+		Tags       []string     `json:"tags"`
+		Visibility *string      `json:"visibility"`
+		Status     *string      `json:"status"`
+		PublishAt  *time.Time   `json:"publish_at"`
+		// lets the edited content match that of another quote, as when creating one
+		AllowDuplicate bool `json:"allow_duplicate,omitempty"`
+	}
+
+	err = app.readJSON(w, r, &input)
 	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	wasListed := quote.Listed()
+
+	if input.Content != nil {
+		quote.Content = *input.Content
+	}
+	if input.Author != nil {
+		quote.Author = *input.Author
+	}
+	if input.Source != nil {
+		quote.Source = *input.Source
+	}
+	if input.Tags != nil {
+		quote.Tags = input.Tags
+	}
+	if input.Visibility != nil {
+		quote.Visibility = *input.Visibility
+	}
+	wasStatus := quote.Status
+	if input.Status != nil {
+		quote.Status = *input.Status
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+		// drafts haven't been published so they have no publish time
+		case quote.Status == data.StatusDraft:
+			quote.PublishAt = nil
+		// the publish time of a quote that was already published has passed, so scheduling it
+		// again needs a new one
+		case quote.Status == data.StatusScheduled && wasStatus != data.StatusScheduled:
+			quote.PublishAt = nil
+		}
+	}
+	if input.PublishAt != nil {
+		quote.PublishAt = input.PublishAt
+	}
+
+	data.NormaliseQuote(quote)
+
+	v := validator.New()
+	data.ValidateQuote(v, quote)
+	// the publish time of a quote that is already scheduled may have passed without the scheduler
+	// having published it yet, that shouldn't stop its other fields from being edited
+	if input.PublishAt != nil || (input.Status != nil && quote.Status == data.StatusScheduled) {
+		data.ValidatePublishAt(v, quote)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// the feed places quotes at their publish time, so a quote published now has to go to the top
+	// of it rather than back to when it was written
+	if quote.Status == data.StatusPublished && wasStatus != data.StatusPublished {
+		publishAt := time.Now()
+		quote.PublishAt = &publishAt
+	}
+
+	if input.Content != nil && !input.AllowDuplicate {
+		existing, err := app.models.Quotes.FindDuplicate(quote.Content, user.ID, quote.ID)
+		switch {
+		case err == nil:
+			app.duplicateQuoteResponse(w, r, existing.ID)
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Quotes.Update(quote)
+		if err != nil {
+			return err
+		}
+
+		// a quote that has just become listed is new to everyone else, so it is announced as created
+		if !wasListed && quote.Listed() {
+			err = app.queueSavedSearchMatch(tx, quote)
+			if err != nil {
+				return err
+			}
+
+			return app.queueCreatedEvent(tx, quote)
+		}
+
+		// the owner's own reaction is only meant for them, not for the receivers of the event
+		eventQuote := *quote
+		eventQuote.MyReaction = nil
+		return app.queueEvent(tx, data.EventQuoteUpdated, quote, envelope{"quote": eventQuote})
+	})
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, envelope{"message": "quote successfully deleted"}, http.StatusOK, nil)
+	err = app.writeJSON(w, envelope{"quote": quote}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listDuplicateQuotesHandler(w http.ResponseWriter, r *http.Request) {
+	var input data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-size")
+	input.SortSafeList = duplicateClusterSortSafeList
+
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	clusters, metadata, err := app.models.Quotes.GetDuplicateClusters(input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"duplicates": clusters, "metadata": metadata}, http.StatusOK, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) LikeQuoteHandler(w http.ResponseWriter, r *http.Request) {
-	quoteID, err := app.readParamByName(r, "quote_id")
+func (app *application) listUserLikesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := app.readUserIDParam(r, "user_id")
 	if err != nil {
 		app.notFoundResponse(w, r)
 		return
 	}
 
+	// what a user has liked is only visible to themselves
 	user := app.contextGetUser(r)
+	if userID != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
 
-	var input struct {
-		LikeType string `json:"like_type"`
+	var input data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-liked_at")
+	input.SortSafeList = likedQuoteSortSafeList
+
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	err = app.readJSON(w, r, &input)
+	quotes, metadata, err := app.models.Quotes.GetAllLikedBy(userID, input)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	v := validator.New()
-	v.Check(input.LikeType == "like" || input.LikeType == "dislike", "like_type", "invalid like type")
-	if !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
+	err = app.writeJSON(w, envelope{"quotes": quotes, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteQuotesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	val := data.LikeType(data.LikeValue)
+	user := app.contextGetUser(r)
 
-	if input.LikeType == "dislike" {
-		val = data.DislikeValue
+	quote, err := app.models.Quotes.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
 
-	like := data.Like{
-		QuoteID: quoteID,
-		UserID:  user.ID,
-		Val:     val,
+	if user.ID != quote.UserID {
+		app.notPermittedResponse(w, r)
+		return
 	}
 
-	err = app.models.Like.LikeOrDislikeQuote(like)
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Quotes.Delete(id)
+		if err != nil {
+			return err
+		}
+
+		return app.queueEvent(tx, data.EventQuoteDeleted, quote, envelope{"quote_id": quote.ID})
+	})
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, envelope{"message": "successful", "like": like}, http.StatusOK, nil)
+	err = app.writeJSON(w, envelope{"message": "quote successfully deleted"}, http.StatusOK, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+func TestDailyQuoteHandlerInvalidTimezone(t *testing.T) {
+	app := mockApp()
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+
+	timezones := []string{
+		"Not/AZone",
+		"Local",
+	}
+
+	for _, tz := range timezones {
+		statusCode, _, body := ts.get(t, "/v1/quotes/daily?tz="+tz)
+		assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "must be a valid IANA time zone name")
+	}
+}
+
+func TestUpdateQuoteHandlerStatusTransitions(t *testing.T) {
+	app, db := newTestApp(t)
+	user := insertTestUser(t, db)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		status     string
+		publishAt  *time.Time
+		body       string
+		wantCode   int
+		wantStatus string
+	}{
+		{
+			name:       "edit a scheduled quote that is waiting to be published",
+			status:     data.StatusScheduled,
+			publishAt:  &past,
+			body:       `{"author": "Someone Else"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: data.StatusScheduled,
+		},
+		{
+			name:       "publish a scheduled quote",
+			status:     data.StatusScheduled,
+			publishAt:  &future,
+			body:       `{"status": "published"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: data.StatusPublished,
+		},
+		{
+			name:       "schedule a draft",
+			status:     data.StatusDraft,
+			body:       fmt.Sprintf(`{"status": "scheduled", "publish_at": %q}`, future.Format(time.RFC3339)),
+			wantCode:   http.StatusOK,
+			wantStatus: data.StatusScheduled,
+		},
+		{
+			name:       "schedule a draft in the past",
+			status:     data.StatusDraft,
+			body:       fmt.Sprintf(`{"status": "scheduled", "publish_at": %q}`, past.Format(time.RFC3339)),
+			wantCode:   http.StatusUnprocessableEntity,
+			wantStatus: data.StatusDraft,
+		},
+		{
+			name:       "publish a draft",
+			status:     data.StatusDraft,
+			body:       `{"status": "published"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: data.StatusPublished,
+		},
+		{
+			name:       "unschedule a quote",
+			status:     data.StatusScheduled,
+			publishAt:  &future,
+			body:       `{"status": "draft"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: data.StatusDraft,
+		},
+		{
+			name:       "give a published quote a publish time",
+			status:     data.StatusPublished,
+			body:       fmt.Sprintf(`{"publish_at": %q}`, future.Format(time.RFC3339)),
+			wantCode:   http.StatusUnprocessableEntity,
+			wantStatus: data.StatusPublished,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			quote := insertTestQuote(t, db, &data.Quote{UserID: user.ID, Status: test.status, PublishAt: test.publishAt})
+
+			code, body := serveAs(t, app, app.updateQuoteHandler, user, http.MethodPatch, "/", test.body, "quote_id", strconv.FormatInt(quote.ID, 10))
+			assert.Equal(t, code, test.wantCode)
+
+			updated, err := app.models.Quotes.Get(quote.ID, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, updated.Status, test.wantStatus)
+
+			if code == http.StatusOK {
+				// drafts have no publish time and quotes that were just published went live now
+				assert.Equal(t, updated.PublishAt != nil, test.wantStatus != data.StatusDraft)
+				if test.wantStatus == data.StatusPublished {
+					assert.Equal(t, updated.PublishAt.Before(future), true)
+				}
+			} else {
+				assert.StringContains(t, body, "publish_at")
+			}
+		})
+	}
+}
+
+func TestUpdateQuoteHandlerPublishDraftFeed(t *testing.T) {
+	app, db := newTestApp(t)
+	author := insertTestUser(t, db)
+	follower := insertTestUser(t, db)
+
+	err := app.models.Follows.Insert(follower.ID, author.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the draft was written before the other quote was published
+	draft := insertTestQuote(t, db, &data.Quote{UserID: author.ID, Status: data.StatusDraft})
+	published := insertTestQuote(t, db, &data.Quote{UserID: author.ID, Content: "Another test quote"})
+	_, err = db.Exec("UPDATE quotes SET created_at = created_at - interval '1 hour' WHERE id = $1", draft.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := serveAs(t, app, app.updateQuoteHandler, author, http.MethodPatch, "/", `{"status": "published"}`, "quote_id", strconv.FormatInt(draft.ID, 10))
+	assert.Equal(t, code, http.StatusOK)
+
+	code, body := serveAs(t, app, app.feedHandler, follower, http.MethodGet, "/v1/feed", "")
+	assert.Equal(t, code, http.StatusOK)
+
+	var output struct {
+		Quotes []*data.Quote `json:"quotes"`
+	}
+	err = json.Unmarshal([]byte(body), &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the draft was published last so it comes first
+	assert.Equal(t, len(output.Quotes), 2)
+	assert.Equal(t, output.Quotes[0].ID, draft.ID)
+	assert.Equal(t, output.Quotes[1].ID, published.ID)
+}
+
+func TestReadQuoteSearchTopWindow(t *testing.T) {
+	app := mockApp()
+
+	tests := []struct {
+		query string
+		sort  string
+		valid bool
+	}{
+		{query: "sort=top", sort: "top_all", valid: true},
+		{query: "sort=top&window=day", sort: "top_day", valid: true},
+		{query: "sort=top&window=month", sort: "top_month", valid: true},
+		{query: "sort=hot&window=day", sort: "hot", valid: true},
+		{query: "sort=top&window=", sort: "top_all", valid: true},
+		{query: "sort=top&window=year", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "/v1/quotes?"+test.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var input quoteSearchFields
+			v := validator.New()
+			app.readQuoteSearch(r, &input, v)
+
+			assert.Equal(t, v.Valid(), test.valid)
+			if test.valid {
+				assert.Equal(t, input.Filters.Sort, test.sort)
+			}
+		})
+	}
+}
+
+func TestListQuotesHandlerInvalidWindow(t *testing.T) {
+	app := mockApp()
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+
+	for _, window := range []string{"year", "DAY", "1d"} {
+		statusCode, _, body := ts.get(t, "/v1/quotes?sort=top&window="+window)
+		assert.Equal(t, statusCode, http.StatusUnprocessableEntity)
+		assert.StringContains(t, body, "must be one of day, week, month or all")
+	}
+}
+
+// queuedCreatedEvents counts the quote.created events queued for the owner's quotes
+func queuedCreatedEvents(t *testing.T, db *sql.DB, ownerID int64) int {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow(`
+		SELECT count(*) FROM jobs
+		WHERE type = $1 AND payload->>'event' = $2 AND (payload->>'owner_id')::bigint = $3`,
+		jobQueueWebhookEvent, data.EventQuoteCreated, ownerID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestQuoteCreatedEvents(t *testing.T) {
+	app, db := newTestApp(t)
+	user := insertTestUser(t, db)
+	t.Cleanup(func() { db.Exec("DELETE FROM jobs WHERE (payload->>'owner_id')::bigint = $1", user.ID) })
+
+	code, body := serveAs(t, app, app.createQuoteHandler, user, http.MethodPost, "/",
+		`{"content": "Not ready yet", "author": "Tester", "tags": ["test"], "status": "draft"}`)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, queuedCreatedEvents(t, db, user.ID), 0)
+
+	var output struct {
+		Quote data.Quote `json:"quote"`
+	}
+	err := json.Unmarshal([]byte(body), &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quoteID := strconv.FormatInt(output.Quote.ID, 10)
+
+	// publishing the draft announces it, later edits don't announce it again
+	code, _ = serveAs(t, app, app.updateQuoteHandler, user, http.MethodPatch, "/", `{"status": "published"}`, "quote_id", quoteID)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, queuedCreatedEvents(t, db, user.ID), 1)
+
+	code, _ = serveAs(t, app, app.updateQuoteHandler, user, http.MethodPatch, "/", `{"author": "Someone Else"}`, "quote_id", quoteID)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, queuedCreatedEvents(t, db, user.ID), 1)
+
+	// scheduled quotes are announced when the scheduler publishes them, unless they are private
+	past := time.Now().Add(-time.Minute)
+	insertTestQuote(t, db, &data.Quote{UserID: user.ID, Status: data.StatusScheduled, PublishAt: &past})
+	insertTestQuote(t, db, &data.Quote{UserID: user.ID, Status: data.StatusScheduled, PublishAt: &past, Visibility: data.VisibilityPrivate})
+
+	err = app.publishScheduledQuotes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, queuedCreatedEvents(t, db, user.ID), 2)
+}
+
+func TestUpdateQuoteHandlerDuplicateContent(t *testing.T) {
+	app, db := newTestApp(t)
+	user := insertTestUser(t, db)
+
+	content := fmt.Sprintf("Said twice %d", time.Now().UnixNano())
+	original := insertTestQuote(t, db, &data.Quote{UserID: user.ID, Content: content})
+	quote := insertTestQuote(t, db, &data.Quote{UserID: user.ID, Content: content + " or not"})
+	quoteID := strconv.FormatInt(quote.ID, 10)
+
+	code, body := serveAs(t, app, app.updateQuoteHandler, user, http.MethodPatch, "/", fmt.Sprintf(`{"content": %q}`, content), "quote_id", quoteID)
+	assert.Equal(t, code, http.StatusConflict)
+	assert.StringContains(t, body, fmt.Sprintf(`"existing_quote_id": %d`, original.ID))
+
+	// edits that leave the content alone don't trip over the quote's own fingerprint
+	code, _ = serveAs(t, app, app.updateQuoteHandler, user, http.MethodPatch, "/", `{"author": "Someone Else"}`, "quote_id", strconv.FormatInt(original.ID, 10))
+	assert.Equal(t, code, http.StatusOK)
+
+	code, _ = serveAs(t, app, app.updateQuoteHandler, user, http.MethodPatch, "/", fmt.Sprintf(`{"content": %q, "allow_duplicate": true}`, content), "quote_id", quoteID)
+	assert.Equal(t, code, http.StatusOK)
+}
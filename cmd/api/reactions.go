@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+func (app *application) setReactionHandler(w http.ResponseWriter, r *http.Request) {
+	quoteID, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Reaction string `json:"reaction"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	reaction, ok := data.ParseLikeType(input.Reaction)
+
+	v := validator.New()
+	v.Check(input.Reaction != "", "reaction", "must be provided")
+	v.Check(ok, "reaction", "must be one of "+strings.Join(data.LikeTypeNames(), ", "))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// users can only react to quotes they are able to see
+	quote, err := app.models.Quotes.Get(quoteID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	like := data.Like{
+		QuoteID: quoteID,
+		UserID:  user.ID,
+		Val:     reaction,
+	}
+
+	err = app.models.Transaction(func(tx data.Models) error {
+		// repeating the reaction the user already had changes nothing worth telling anyone about
+		changed, err := tx.Like.SetReaction(like)
+		if err != nil || !changed {
+			return err
+		}
+
+		// owners aren't told about dislikes
+		if reaction != data.DislikeValue {
+			err = app.queueNotification(tx, data.Notification{
+				UserID:  quote.UserID,
+				ActorID: user.ID,
+				Type:    data.NotificationReaction,
+				QuoteID: &quote.ID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return app.queueEvent(tx, data.EventQuoteReacted, quote, envelope{"reaction": like})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrForeignKeyViolation):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"reaction": like}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) clearReactionHandler(w http.ResponseWriter, r *http.Request) {
+	quoteID, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Like.ClearReaction(user.ID, quoteID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "reaction successfully removed"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+)
+
+// queuedNotifications counts the notification jobs queued for actions by the user
+func queuedNotifications(t *testing.T, db *sql.DB, actorID int64) int {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow(`
+		SELECT count(*) FROM jobs
+		WHERE type = $1 AND (payload->>'actor_id')::bigint = $2`, jobCreateNotification, actorID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestSetReactionHandlerNotifications(t *testing.T) {
+	app, db := newTestApp(t)
+
+	owner := insertTestUser(t, db)
+	reactor := insertTestUser(t, db)
+	t.Cleanup(func() { db.Exec("DELETE FROM jobs WHERE (payload->>'actor_id')::bigint = $1", reactor.ID) })
+
+	quote := insertTestQuote(t, db, &data.Quote{UserID: owner.ID})
+	quoteID := strconv.FormatInt(quote.ID, 10)
+
+	react := func(reaction string) {
+		code, _ := serveAs(t, app, app.setReactionHandler, reactor, http.MethodPut, "/", `{"reaction": "`+reaction+`"}`, "quote_id", quoteID)
+		assert.Equal(t, code, http.StatusOK)
+	}
+
+	react("dislike")
+	assert.Equal(t, queuedNotifications(t, db, reactor.ID), 0)
+
+	react("like")
+	assert.Equal(t, queuedNotifications(t, db, reactor.ID), 1)
+
+	// repeating the same reaction changes nothing
+	react("like")
+	assert.Equal(t, queuedNotifications(t, db, reactor.ID), 1)
+
+	react("love")
+	assert.Equal(t, queuedNotifications(t, db, reactor.ID), 2)
+}
@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/WanderingAura/quotable/internal/validator"
 )
@@ -57,3 +58,17 @@ func (app *application) readBool(qs url.Values, key string, defaultValue bool, v
 		return defaultValue
 	}
 }
+
+// readTimezone reads an IANA time zone name, rejecting "Local" since it would make the answer
+// depend on the server's configuration
+func (app *application) readTimezone(qs url.Values, key string, defaultValue string, v *validator.Validator) *time.Location {
+	name := app.readString(qs, key, defaultValue)
+
+	location, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		v.AddError(key, "must be a valid IANA time zone name")
+		return time.UTC
+	}
+
+	return location
+}
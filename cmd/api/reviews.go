@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Where quotes can be enrolled in reviews from
+const (
+	reviewSourceLikes      = "likes"
+	reviewSourceCollection = "collection"
+)
+
+// httprouter doesn't let a fixed path segment share its position with a named parameter, so
+// POST /v1/review/enrol is dispatched on the value of :quote_id here
+func (app *application) dispatchReviewHandler(w http.ResponseWriter, r *http.Request) {
+	switch httprouter.ParamsFromContext(r.Context()).ByName("quote_id") {
+	case "enrol":
+		app.enrolReviewHandler(w, r)
+	default:
+		app.gradeReviewHandler(w, r)
+	}
+}
+
+// enrolReviewHandler adds the quotes the user has liked, or the quotes in a collection they can
+// see, to their reviews. quote_ids limits it to some of those quotes.
+func (app *application) enrolReviewHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Source       string  `json:"source"`
+		CollectionID int64   `json:"collection_id"`
+		QuoteIDs     []int64 `json:"quote_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(validator.In(input.Source, reviewSourceLikes, reviewSourceCollection), "source", "must be likes or collection")
+	v.Check(input.Source != reviewSourceCollection || input.CollectionID > 0, "collection_id", "must be provided for collections")
+	v.Check(len(input.QuoteIDs) <= 100, "quote_ids", "must not contain more than 100 IDs")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	if input.Source == reviewSourceCollection {
+		_, err = app.models.Collections.Get(input.CollectionID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("collection_id", "must refer to an existing collection")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	var enrolled int64
+
+	switch input.Source {
+	case reviewSourceLikes:
+		enrolled, err = app.models.Reviews.EnrolLiked(user.ID, input.QuoteIDs)
+	case reviewSourceCollection:
+		enrolled, err = app.models.Reviews.EnrolCollection(user.ID, input.CollectionID, input.QuoteIDs)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"enrolled": enrolled}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// gradeReviewHandler records how well the user recalled the quote, from 0 for a blackout to 5 for
+// a perfect response, and schedules its next review
+func (app *application) gradeReviewHandler(w http.ResponseWriter, r *http.Request) {
+	quoteID, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Grade *int `json:"grade"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Grade != nil, "grade", "must be provided")
+	v.Check(input.Grade == nil || (*input.Grade >= data.MinGrade && *input.Grade <= data.MaxGrade), "grade", "must be between 0 and 5")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	card, err := app.models.Reviews.Get(user.ID, quoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	card.Review(*input.Grade, time.Now())
+
+	err = app.models.Reviews.Update(card)
+	if err != nil {
+		switch {
+		// the card was removed while it was being graded
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"card": card}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listDueReviewsHandler lists the cards that are due by the end of today, the day being taken in
+// the time zone given by tz
+func (app *application) listDueReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	location := app.readTimezone(qs, "tz", "UTC", v)
+	limit := app.readInt(qs, "limit", 20, v)
+	v.Check(limit > 0 && limit <= 100, "limit", "must be between 1 and 100")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	now := time.Now().In(location)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, location)
+
+	user := app.contextGetUser(r)
+
+	cards, err := app.models.Reviews.GetDue(user.ID, tomorrow, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"cards": cards, "date": now.Format(time.DateOnly)}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	quoteID, err := app.readParamByName(r, "quote_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Reviews.Delete(user.ID, quoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "quote successfully removed from reviews"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportReviewsHandler downloads all of the user's cards as a CSV file that Anki can import
+func (app *application) exportReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	cards, err := app.models.Reviews.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="quotable-reviews.csv"`)
+
+	err = writeAnkiCSV(w, cards)
+	if err != nil {
+		// the response has already started so all that can be done is log it
+		app.logger.Error().Err(err).Msg("failed to write review export")
+	}
+}
+
+// writeAnkiCSV writes the cards as notes with the quote on the front and who said it on the back.
+// The header lines tell Anki (2.1.55 and later) how to read the file: its separator, that the
+// fields are plain text and that the third column holds the tags.
+func writeAnkiCSV(w io.Writer, cards []*data.ReviewCard) error {
+	_, err := io.WriteString(w, "#separator:comma\n#html:false\n#columns:Front,Back,Tags\n#tags column:3\n")
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+
+	for _, card := range cards {
+		back := card.Quote.Author
+		if card.Quote.Source.Title != "" {
+			back = fmt.Sprintf("%s, %s", back, card.Quote.Source.Title)
+		}
+
+		// Anki separates tags with spaces
+		tags := make([]string, len(card.Quote.Tags))
+		for i, tag := range card.Quote.Tags {
+			tags[i] = strings.Join(strings.Fields(tag), "_")
+		}
+
+		err = cw.Write([]string{card.Quote.Content, back, strings.Join(tags, " ")})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
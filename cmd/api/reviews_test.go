@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+)
+
+func TestWriteAnkiCSV(t *testing.T) {
+	cards := []*data.ReviewCard{
+		{Quote: &data.Quote{
+			Content: "Waste no more time arguing what a good man should be. Be one.",
+			Author:  "Marcus Aurelius",
+			Source:  data.Source{Title: "Meditations", Type: "book"},
+			Tags:    []string{"stoicism", "virtue ethics"},
+		}},
+		{Quote: &data.Quote{
+			Content: "He said \"no\",\nthen left.",
+			Author:  "Anonymous",
+			Tags:    []string{"test"},
+		}},
+	}
+
+	var buf bytes.Buffer
+	err := writeAnkiCSV(&buf, cards)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "#separator:comma\n#html:false\n#columns:Front,Back,Tags\n#tags column:3\n" +
+		"Waste no more time arguing what a good man should be. Be one.,\"Marcus Aurelius, Meditations\",stoicism virtue_ethics\n" +
+		"\"He said \"\"no\"\",\nthen left.\",Anonymous,test\n"
+	assert.Equal(t, buf.String(), want)
+}
+
+func TestReviewRoutes(t *testing.T) {
+	app := mockApp()
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+
+	// the review endpoints are only for signed in users
+	for _, path := range []string{"/v1/review/due", "/v1/review/export"} {
+		statusCode, _, _ := ts.get(t, path)
+		assert.Equal(t, statusCode, http.StatusUnauthorized)
+	}
+}
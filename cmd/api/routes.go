@@ -17,13 +17,76 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/version", app.versionCheckHandler)
 
 	router.HandlerFunc(http.MethodGet, "/v1/quotes", app.listQuotesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/stream", app.streamHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/live/reactions", app.reactionSocketHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/auth", app.createAuthenticationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/user/register", app.registerUserHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/quotes/:quote_id", app.getQuoteHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/quotes/:quote_id", app.dispatchQuoteHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/quotes/:quote_id", app.requireAuthenticatedUser(app.updateQuoteHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/quotes/:quote_id", app.requireAuthenticatedUser(app.deleteQuotesHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/quotes/:quote_id/like", app.requireAuthenticatedUser(app.LikeQuoteHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/quotes/:quote_id/reaction", app.requireAuthenticatedUser(app.setReactionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/quotes/:quote_id/reaction", app.requireAuthenticatedUser(app.clearReactionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/quotes/:quote_id/comments", app.listQuoteCommentsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/quotes/:quote_id/comments", app.requireActivatedUser(app.createCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/quotes/:quote_id/note", app.requireAuthenticatedUser(app.getNoteHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/quotes/:quote_id/note", app.requireAuthenticatedUser(app.setNoteHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/quotes/:quote_id/note", app.requireAuthenticatedUser(app.deleteNoteHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/quotes", app.requireAuthenticatedUser(app.createQuoteHandler))
+
+	router.HandlerFunc(http.MethodPatch, "/v1/comments/:comment_id", app.requireAuthenticatedUser(app.updateCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/comments/:comment_id", app.requireAuthenticatedUser(app.deleteCommentHandler))
+
 	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id/quotes", app.requireAuthenticatedUser(app.listUserQuotesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id/likes", app.requireAuthenticatedUser(app.listUserLikesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id/collections", app.requireAuthenticatedUser(app.listUserCollectionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id/followers", app.requireAuthenticatedUser(app.listFollowersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:user_id/following", app.requireAuthenticatedUser(app.listFollowingHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/:user_id/follow", app.requireActivatedUser(app.followUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/:user_id/follow", app.requireAuthenticatedUser(app.unfollowUserHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/notes", app.requireAuthenticatedUser(app.listNotesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/feed", app.requireAuthenticatedUser(app.feedHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/notifications", app.requireAuthenticatedUser(app.listNotificationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/notifications/read", app.requireAuthenticatedUser(app.markNotificationsReadHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/notifications/preferences", app.requireAuthenticatedUser(app.getNotificationPreferencesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/notifications/preferences", app.requireAuthenticatedUser(app.updateNotificationPreferencesHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.requireAuthenticatedUser(app.createCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:collection_id", app.getCollectionHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:collection_id", app.requireAuthenticatedUser(app.updateCollectionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:collection_id", app.requireAuthenticatedUser(app.deleteCollectionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections/:collection_id/quotes", app.requireAuthenticatedUser(app.addCollectionQuoteHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:collection_id/quotes/:quote_id", app.requireAuthenticatedUser(app.moveCollectionQuoteHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:collection_id/quotes/:quote_id", app.requireAuthenticatedUser(app.removeCollectionQuoteHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/review/due", app.requireAuthenticatedUser(app.listDueReviewsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/review/export", app.requireAuthenticatedUser(app.exportReviewsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/review/:quote_id", app.requireAuthenticatedUser(app.dispatchReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/review/:quote_id", app.requireAuthenticatedUser(app.deleteReviewHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/searches", app.requireActivatedUser(app.createSavedSearchHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/searches", app.requireAuthenticatedUser(app.listSavedSearchesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/searches/:search_id", app.requireAuthenticatedUser(app.deleteSavedSearchHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/searches/:search_id/quotes", app.requireAuthenticatedUser(app.listSavedSearchQuotesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/digest/preferences", app.requireAuthenticatedUser(app.getDigestPreferencesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/digest/preferences", app.requireActivatedUser(app.updateDigestPreferencesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/digest/unsubscribe", app.unsubscribeDigestPageHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/digest/unsubscribe", app.unsubscribeDigestHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks", app.requireActivatedUser(app.createWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks", app.requireAuthenticatedUser(app.listWebhooksHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/webhooks/:webhook_id", app.requireAuthenticatedUser(app.deleteWebhookHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/webhooks/:webhook_id/deliveries", app.requireAuthenticatedUser(app.listWebhookDeliveriesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", app.requireAuthenticatedUser(app.redeliverWebhookHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/quotes/duplicates", app.requirePermission("quotes:admin", app.listDuplicateQuotesHandler))
+
+	if app.config.env == "development" {
+		router.HandlerFunc(http.MethodGet, "/debug/emails/:template", app.previewEmailHandler)
+	}
 
 	// Set up the relevant middleware before returning the handler
 	return app.rateLimit(app.authenticate(router))
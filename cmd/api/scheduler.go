@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/data"
+)
+
+// Launches the periodic background jobs. The jobs keep no state between runs, everything they
+// need is read back from the database, so they carry on where they left off after a restart.
+func (app *application) startSchedulers(stop <-chan struct{}) {
+	app.runPeriodically("publish_scheduled_quotes", app.config.scheduler.publishInterval, stop, app.publishScheduledQuotes)
+	app.runPeriodically("refresh_quote_scores", app.config.scheduler.scoresRefreshInterval, stop, app.models.Quotes.RefreshScores)
+	app.runPeriodically("deliver_webhooks", app.config.webhooks.interval, stop, app.deliverWebhooks)
+	app.runPeriodically("prune_stream_events", 10*time.Minute, stop, app.pruneStreamEvents)
+	app.runPeriodically("queue_digests", app.config.scheduler.digestInterval, stop, app.queueDigests)
+}
+
+// runs fn straight away and then once every interval until stop is closed. Errors and panics
+// are logged and don't stop later runs.
+func (app *application) runPeriodically(name string, interval time.Duration, stop <-chan struct{}, fn func() error) {
+	run := func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error().Str("job", name).Err(fmt.Errorf("%s", err)).Msg("scheduled job panicked")
+			}
+		}()
+
+		if err := fn(); err != nil {
+			app.logger.Error().Str("job", name).Err(err).Stack().Msg("scheduled job failed")
+		}
+	}
+
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			run()
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// publishScheduledQuotes publishes the quotes that are due and, in the same transaction, queues
+// matching them against saved searches and the quote.created event for those that became listed
+func (app *application) publishScheduledQuotes() error {
+	var ids []int64
+
+	err := app.models.Transaction(func(tx data.Models) error {
+		quotes, err := tx.Quotes.PublishScheduled()
+		if err != nil {
+			return err
+		}
+
+		for _, quote := range quotes {
+			ids = append(ids, quote.ID)
+
+			err = app.queueSavedSearchMatch(tx, quote)
+			if err != nil {
+				return err
+			}
+
+			err = app.queueCreatedEvent(tx, quote)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		app.logger.Info().Ints64("quote_ids", ids).Msg("published scheduled quotes")
+	}
+
+	return nil
+}
+
+func (app *application) pruneStreamEvents() error {
+	_, err := app.models.StreamEvents.Prune(app.config.stream.retention)
+	return err
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+type matchSavedSearchesJob struct {
+	QuoteID int64 `json:"quote_id"`
+}
+
+// queueSavedSearchMatch queues matching the quote against everyone's saved searches if it has just
+// become listed. Quotes that aren't listed yet are matched once they are, when they are published
+// by the scheduler or made public.
+func (app *application) queueSavedSearchMatch(models data.Models, quote *data.Quote) error {
+	if !quote.Listed() {
+		return nil
+	}
+
+	return app.enqueueJob(models, jobMatchSavedSearches, matchSavedSearchesJob{QuoteID: quote.ID})
+}
+
+// runMatchSavedSearchesJob alerts the owners of the saved searches that a new quote matches. The
+// matches are recorded in the same transaction as the alerts, so a retried job doesn't alert
+// anyone twice.
+func (app *application) runMatchSavedSearchesJob(payload json.RawMessage) error {
+	var job matchSavedSearchesJob
+	err := decodeJobPayload(payload, &job)
+	if err != nil {
+		return err
+	}
+
+	quote, err := app.models.Quotes.Get(job.QuoteID, data.AnonymousUser.ID)
+	if err != nil {
+		switch {
+		// the quote was deleted or hidden before the job ran
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	return app.models.Transaction(func(tx data.Models) error {
+		searches, err := tx.SavedSearches.Match(quote.ID)
+		if err != nil {
+			return err
+		}
+
+		// users with several matching searches only hear about the quote once per alert type
+		type recipient struct {
+			userID int64
+			alert  string
+		}
+		alerted := make(map[recipient]bool)
+
+		for _, search := range searches {
+			key := recipient{search.UserID, search.Alert}
+			if alerted[key] {
+				continue
+			}
+			alerted[key] = true
+
+			switch search.Alert {
+			case data.AlertInApp:
+				err = tx.Notifications.Insert(&data.Notification{
+					UserID:  search.UserID,
+					ActorID: quote.UserID,
+					Type:    data.NotificationSavedSearch,
+					QuoteID: &quote.ID,
+				})
+			case data.AlertEmail:
+				err = app.queueSavedSearchEmail(tx, search, quote)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (app *application) queueSavedSearchEmail(tx data.Models, search *data.SavedSearch, quote *data.Quote) error {
+	user, err := tx.Users.Get(search.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !user.Activated {
+		return nil
+	}
+
+	return app.enqueueJob(tx, jobSendEmail, sendEmailJob{
+		Recipient: user.Email,
+		Locale:    user.Locale,
+		Template:  "saved_search_match",
+		Data: map[string]interface{}{
+			"username":   user.Username,
+			"searchID":   search.ID,
+			"searchName": search.Name,
+			"quoteID":    quote.ID,
+			"content":    quote.Content,
+			"author":     quote.Author,
+		},
+	})
+}
+
+func (app *application) createSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string   `json:"name"`
+		Content string   `json:"content"`
+		Author  string   `json:"author"`
+		Tags    []string `json:"tags"`
+		// one of in_app, email or none. Defaults to in_app
+		Alert string `json:"alert"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	search := &data.SavedSearch{
+		UserID: user.ID,
+		Name:   input.Name,
+		QuoteSearch: data.QuoteSearch{
+			Content: input.Content,
+			Author:  input.Author,
+			Tags:    input.Tags,
+		},
+		Alert: input.Alert,
+	}
+
+	if search.Alert == "" {
+		search.Alert = data.AlertInApp
+	}
+
+	data.NormaliseSavedSearch(search)
+
+	v := validator.New()
+	if data.ValidateSavedSearch(v, search); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.SavedSearches.Insert(search)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.Is(err, data.ErrTooManySavedSearches):
+			v.AddError("saved_searches", fmt.Sprintf("you can't have more than %d saved searches", data.MaxSavedSearches))
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"saved_search": search}, http.StatusCreated, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	searches, err := app.models.SavedSearches.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"saved_searches": searches}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listSavedSearchQuotesHandler runs the saved search, taking the page, page_size and sort from the
+// query string like GET /v1/quotes
+func (app *application) listSavedSearchQuotesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamByName(r, "search_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input quoteSearchFields
+	v := validator.New()
+	app.readQuoteSearch(r, &input, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	search, err := app.models.SavedSearches.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	quotes, metadata, err := app.models.Quotes.GetAll(user.ID, search.QuoteSearch, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"quotes": quotes, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamByName(r, "search_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.SavedSearches.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "saved search successfully deleted"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
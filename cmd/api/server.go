@@ -22,8 +22,21 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	err := app.startStream()
+	if err != nil {
+		return err
+	}
+	// streaming requests never finish on their own, so they have to be ended for Shutdown to return
+	srv.RegisterOnShutdown(app.stream.Close)
+
 	shutdownError := make(chan error)
 
+	// closed on shutdown to tell the schedulers and job workers to finish what they are running
+	// and return
+	stopWorkers := make(chan struct{})
+	app.startSchedulers(stopWorkers)
+	app.startJobWorkers(stopWorkers)
+
 	go func() {
 		quit := make(chan os.Signal, 1) // use a buffer size of 1 to avoid missing signals when quit is not ready to receive
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -42,13 +55,15 @@ func (app *application) serve() error {
 
 		app.logger.Info().Msgf("completing background tasks, port: %s", srv.Addr)
 
+		close(stopWorkers)
+
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
 
 	app.logger.Info().Msgf("starting server, port: %s, env: %s", srv.Addr, app.config.env)
 
-	err := srv.ListenAndServe()
+	err = srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
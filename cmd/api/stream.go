@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// how many events a client can fall behind by before it is disconnected
+	streamBufferSize = 64
+	// how many stored events are read at a time when a client resumes
+	streamReplayBatch    = 500
+	streamHeartbeat      = 15 * time.Second
+	streamListenerPing   = 90 * time.Second
+	streamListenerMinGap = 10 * time.Second
+	streamListenerMaxGap = time.Minute
+)
+
+// streamFilter picks the events a client is interested in. Empty fields match everything.
+type streamFilter struct {
+	tags   []string
+	userID int64
+	types  []string
+	// nil matches every quote, an empty set matches none
+	quoteIDs map[int64]bool
+}
+
+func (f streamFilter) matches(event *data.StreamEvent) bool {
+	if f.userID != 0 && event.UserID != f.userID {
+		return false
+	}
+	if len(f.types) > 0 && !validator.In(event.Type, f.types...) {
+		return false
+	}
+	if f.quoteIDs != nil && !f.quoteIDs[event.QuoteID] {
+		return false
+	}
+	if len(f.tags) == 0 {
+		return true
+	}
+	for _, tag := range f.tags {
+		if validator.In(tag, event.Tags...) {
+			return true
+		}
+	}
+	return false
+}
+
+type streamSubscriber struct {
+	filter streamFilter
+	events chan *data.StreamEvent
+}
+
+// streamBroker fans the events published by postgres out to the clients of GET /v1/stream on
+// this instance. Every instance listens on the same channel so clients see every event no matter
+// which instance they are connected to.
+type streamBroker struct {
+	logger      *zerolog.Logger
+	events      data.StreamEventDatabaseModel
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]struct{}
+	lastID      int64
+	closed      bool
+	done        chan struct{}
+}
+
+func newStreamBroker(logger *zerolog.Logger, events data.StreamEventDatabaseModel) *streamBroker {
+	return &streamBroker{
+		logger:      logger,
+		events:      events,
+		subscribers: make(map[*streamSubscriber]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// startStream connects the broker to postgres and forwards notifications to it until it is closed
+func (app *application) startStream() error {
+	listener := pq.NewListener(app.config.db.dsn, streamListenerMinGap, streamListenerMaxGap, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.Error().Err(err).Msg("stream listener connection problem")
+		}
+	})
+
+	err := listener.Listen(data.StreamChannel)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	app.stream = newStreamBroker(app.logger, app.models.StreamEvents)
+
+	app.background(func() {
+		app.stream.listen(listener)
+	})
+
+	return nil
+}
+
+func (b *streamBroker) listen(listener *pq.Listener) {
+	defer listener.Close()
+
+	ping := time.NewTicker(streamListenerPing)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case n := <-listener.Notify:
+			// a nil notification means the connection was re-established, anything published
+			// while it was down has to be read back from the table
+			if n == nil {
+				b.replay()
+				continue
+			}
+
+			var event data.StreamEvent
+			err := json.Unmarshal([]byte(n.Extra), &event)
+			if err != nil {
+				b.logger.Error().Err(err).Msg("invalid stream notification")
+				continue
+			}
+			b.publish(&event)
+		case <-ping.C:
+			// the listener only notices a dead connection when it is used
+			go listener.Ping()
+		}
+	}
+}
+
+func (b *streamBroker) replay() {
+	b.mu.Lock()
+	lastID := b.lastID
+	b.mu.Unlock()
+
+	// nothing has been seen yet so there's nothing to catch up on
+	if lastID == 0 {
+		return
+	}
+
+	for {
+		events, err := b.events.GetSince(lastID, streamReplayBatch)
+		if err != nil {
+			b.logger.Error().Err(err).Msg("failed to replay stream events")
+			return
+		}
+
+		for _, event := range events {
+			b.publish(event)
+			lastID = event.ID
+		}
+
+		if len(events) < streamReplayBatch {
+			return
+		}
+	}
+}
+
+// publish sends the event to every subscriber whose filter matches. Subscribers that have fallen
+// too far behind are disconnected rather than holding up everyone else, they can resume from the
+// last event they received.
+func (b *streamBroker) publish(event *data.StreamEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// notifications arrive in commit order, which isn't always ID order, so events with lower IDs
+	// than ones already seen are still sent
+	b.lastID = max(b.lastID, event.ID)
+
+	for sub := range b.subscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// subscribe returns false if the broker has been closed
+func (b *streamBroker) subscribe(filter streamFilter) (*streamSubscriber, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, false
+	}
+
+	sub := &streamSubscriber{
+		filter: filter,
+		events: make(chan *data.StreamEvent, streamBufferSize),
+	}
+	b.subscribers[sub] = struct{}{}
+
+	return sub, true
+}
+
+// updateFilter changes the subscriber's filter while holding the lock that publish filters under
+func (b *streamBroker) updateFilter(sub *streamSubscriber, update func(filter *streamFilter)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	update(&sub.filter)
+}
+
+func (b *streamBroker) unsubscribe(sub *streamSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Close disconnects every client and stops listening for events
+func (b *streamBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, event *data.StreamEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
+
+// streamHandler streams quote.created, quote.deleted and quote.reacted events for public quotes as
+// Server-Sent Events, optionally only for the given tags or user. Clients that reconnect with the
+// Last-Event-ID header are sent the events they missed first, as long as they are still stored.
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filter := streamFilter{
+		tags:   app.readCSV(qs, "tags", []string{}),
+		userID: int64(app.readInt(qs, "user_id", 0, v)),
+	}
+	v.Check(filter.userID >= 0, "user_id", "must be a positive integer")
+
+	var lastEventID int64
+	resume := r.Header.Get("Last-Event-ID")
+	if resume != "" {
+		var err error
+		lastEventID, err = strconv.ParseInt(resume, 10, 64)
+		v.Check(err == nil && lastEventID >= 0, "Last-Event-ID", "must be the ID of a previous event")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// subscribe before reading missed events so nothing published in between is lost, the events
+	// that were both read back and published are only sent once
+	sub, ok := app.stream.subscribe(filter)
+	if !ok {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "the server is shutting down")
+		return
+	}
+	defer app.stream.unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+
+	// the server's write timeout would otherwise cut the stream off
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	replayed := make(map[int64]bool)
+	for after := lastEventID; resume != ""; {
+		events, err := app.models.StreamEvents.GetSince(after, streamReplayBatch)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		for _, event := range events {
+			after = event.ID
+			if !filter.matches(event) {
+				continue
+			}
+			replayed[event.ID] = true
+			if writeStreamEvent(w, event) != nil {
+				return
+			}
+		}
+
+		if len(events) < streamReplayBatch {
+			break
+		}
+	}
+
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if replayed[event.ID] {
+				continue
+			}
+			err = writeStreamEvent(w, event)
+		case <-heartbeat.C:
+			// keeps proxies from closing the connection while nothing is happening
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
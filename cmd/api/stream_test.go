@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+)
+
+func TestStreamHandler(t *testing.T) {
+	app := mockApp()
+	app.stream = newStreamBroker(app.logger, data.StreamEventDatabaseModel{})
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+	defer app.stream.Close()
+
+	res, err := ts.Client().Get(ts.URL + "/v1/stream?tags=life")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	assert.Equal(t, res.StatusCode, http.StatusOK)
+	assert.Equal(t, res.Header.Get("Content-Type"), "text/event-stream")
+
+	// the handler has subscribed by the time the headers have been sent
+	app.stream.publish(&data.StreamEvent{ID: 1, Type: "quote.created", Tags: []string{"love"}, Data: []byte(`{"id":1}`)})
+	app.stream.publish(&data.StreamEvent{ID: 2, Type: "quote.created", Tags: []string{"life"}, Data: []byte(`{"id":2}`)})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	var event []string
+	for len(event) < 3 {
+		select {
+		case line := <-lines:
+			event = append(event, line)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event, got %q", event)
+		}
+	}
+
+	assert.Equal(t, strings.Join(event, "\n"), "id: 2\nevent: quote.created\ndata: {\"id\":2}")
+}
+
+func TestStreamHandlerInvalidLastEventID(t *testing.T) {
+	app := mockApp()
+	app.stream = newStreamBroker(app.logger, data.StreamEventDatabaseModel{})
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "abc")
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	assert.Equal(t, res.StatusCode, http.StatusUnprocessableEntity)
+}
+
+func TestStreamBrokerDropsSlowSubscribers(t *testing.T) {
+	logger := mockApp().logger
+	broker := newStreamBroker(logger, data.StreamEventDatabaseModel{})
+
+	slow, _ := broker.subscribe(streamFilter{})
+	filtered, _ := broker.subscribe(streamFilter{userID: 7})
+
+	for id := int64(1); id <= streamBufferSize+1; id++ {
+		broker.publish(&data.StreamEvent{ID: id, UserID: 1})
+	}
+
+	received := 0
+	for range slow.events {
+		received++
+	}
+	assert.Equal(t, received, streamBufferSize)
+
+	// the filtered subscriber wasn't sent anything so it is still connected
+	broker.publish(&data.StreamEvent{ID: 100, UserID: 7})
+	event := <-filtered.events
+	assert.Equal(t, event.ID, int64(100))
+
+	broker.Close()
+	_, ok := <-filtered.events
+	assert.Equal(t, ok, false)
+
+	_, ok = broker.subscribe(streamFilter{})
+	assert.Equal(t, ok, false)
+}
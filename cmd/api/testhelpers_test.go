@@ -2,11 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/mailer"
+	"github.com/julienschmidt/httprouter"
+	_ "github.com/lib/pq"
 	"github.com/rs/zerolog"
 )
 
@@ -27,9 +37,14 @@ func mockApp() *application {
 		logPath: "./logs/quotable.log",
 	}
 	logger := zerolog.New(io.Discard).With().Timestamp().Logger()
+	templates, err := mailer.LoadTemplates()
+	if err != nil {
+		panic(err)
+	}
 	return &application{
-		logger: &logger,
-		config: defaultCfg,
+		logger:    &logger,
+		config:    defaultCfg,
+		templates: templates,
 	}
 }
 
@@ -73,3 +88,120 @@ func handlerResponse(t *testing.T, handler http.Handler) (int, http.Header, stri
 	return response.StatusCode, response.Header, string(body)
 
 }
+
+// newTestApp returns a mock application whose models use the database named by
+// QUOTABLE_TEST_DB_DSN, which must have every migration applied. Tests using it are skipped when
+// the variable isn't set.
+func newTestApp(t *testing.T) (*application, *sql.DB) {
+	t.Helper()
+
+	dsn := os.Getenv("QUOTABLE_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("QUOTABLE_TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := mockApp()
+	app.models = data.New(db)
+
+	return app, db
+}
+
+// insertTestUser inserts an activated user that is deleted, along with everything they own, when
+// the test finishes
+func insertTestUser(t *testing.T, db *sql.DB) *data.User {
+	t.Helper()
+
+	user := &data.User{
+		Username:  "test",
+		Email:     fmt.Sprintf("test-%d@example.com", time.Now().UnixNano()),
+		Activated: true,
+		Locale:    "en",
+	}
+
+	err := db.QueryRow(`
+		INSERT INTO users (username, email, password_hash, activated)
+		VALUES ($1, $2, 'hash', true)
+		RETURNING id, created_at`, user.Username, user.Email).Scan(&user.ID, &user.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = $1", user.ID) })
+
+	return user
+}
+
+// insertTestQuote inserts the quote after filling in the fields left empty with those of a
+// published public test quote
+func insertTestQuote(t *testing.T, db *sql.DB, quote *data.Quote) *data.Quote {
+	t.Helper()
+
+	if quote.Content == "" {
+		quote.Content = "A test quote"
+	}
+	if quote.Author == "" {
+		quote.Author = "Tester"
+	}
+	if quote.Tags == nil {
+		quote.Tags = []string{"test"}
+	}
+	if quote.Visibility == "" {
+		quote.Visibility = data.VisibilityPublic
+	}
+	if quote.Status == "" {
+		quote.Status = data.StatusPublished
+	}
+
+	quotes := data.QuoteDatabaseModel{DB: db}
+	err := quotes.Insert(quote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return quote
+}
+
+// serveAs calls the handler with a request made by the user, as the authenticate middleware and
+// the router would pass it on, and returns the response. params are the route parameters as name
+// and value pairs.
+func serveAs(t *testing.T, app *application, handler http.HandlerFunc, user *data.User, method, target, body string, params ...string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var routeParams httprouter.Params
+	for i := 0; i+1 < len(params); i += 2 {
+		routeParams = append(routeParams, httprouter.Param{Key: params[i], Value: params[i+1]})
+	}
+
+	ctx := context.WithValue(req.Context(), httprouter.ParamsKey, routeParams)
+	req = app.contextSetUser(req.WithContext(ctx), user)
+
+	responseRecorder := httptest.NewRecorder()
+	handler.ServeHTTP(responseRecorder, req)
+
+	response := responseRecorder.Result()
+	defer response.Body.Close()
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response.StatusCode, string(respBody)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"time"
@@ -14,6 +15,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Username string `json:"username"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Locale   string `json:"locale"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -25,6 +27,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	user := &data.User{
 		Username: input.Username,
 		Email:    input.Email,
+		Locale:   data.NormaliseLocale(input.Locale),
 	}
 
 	err = user.Password.Set(input.Password)
@@ -39,42 +42,91 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	// the user, their permissions and the job sending the welcome email are all created in one
+	// transaction, so every user has the email queued and it is only sent once the user definitely
+	// exists. The activation token is created by the job when the email goes out.
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Users.Insert(user)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Permissions.AddForUser(user.ID, "quotes:read")
+		if err != nil {
+			return err
+		}
+
+		return app.enqueueJob(tx, jobSendWelcomeEmail, sendWelcomeEmailJob{UserID: user.ID})
+	})
 	if err != nil {
+		var constraintErr *data.ConstraintError
 		switch {
-		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "there is already a registered user with that email")
-			app.failedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "quotes:read")
-
-	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	err = app.writeJSON(w, envelope{"user": user}, http.StatusAccepted, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
+	}
+}
+
+type sendWelcomeEmailJob struct {
+	UserID int64 `json:"user_id"`
+}
+
+// runSendWelcomeEmailJob sends the welcome email with a new activation token. The token is only
+// created when the email is sent so its plaintext is never stored in the job. Each attempt replaces
+// the tokens created by earlier ones, so a retried job leaves the user with a single token.
+func (app *application) runSendWelcomeEmailJob(payload json.RawMessage) error {
+	var job sendWelcomeEmailJob
+	err := decodeJobPayload(payload, &job)
+	if err != nil {
+		return err
 	}
 
-	app.background(func() {
-		data := map[string]interface{}{
-			"userID":          user.ID,
-			"username":        user.Username,
-			"activationToken": token.Plaintext,
-		}
-		err = app.mailer.Send(user.Email, "user_welcome.tmpl", data)
-		if err != nil {
-			app.logError(r, err)
+	user, err := app.models.Users.Get(job.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return nil
+		default:
+			return err
 		}
-	})
+	}
 
-	err = app.writeJSON(w, envelope{"user": user}, http.StatusAccepted, nil)
+	if user.Activated {
+		return nil
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		return err
 	}
+
+	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	err = app.mailer.Send(user.Email, user.Locale, "user_welcome", map[string]interface{}{
+		"userID":          user.ID,
+		"username":        user.Username,
+		"activationToken": token.Plaintext,
+	})
+	if err != nil {
+		// the token never reached the user, so it shouldn't stay valid until the retry replaces it
+		if deleteErr := app.models.Tokens.Delete(token); deleteErr != nil {
+			app.logger.Error().Err(deleteErr).Int64("user_id", user.ID).Msg("failed to delete unsent activation token")
+		}
+		return err
+	}
+
+	return nil
 }
 
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -109,23 +161,27 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	user.Activated = true
 
-	err = app.models.Users.Update(user)
+	err = app.models.Transaction(func(tx data.Models) error {
+		err := tx.Users.Update(user)
+		if err != nil {
+			return err
+		}
+
+		return tx.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	})
 	if err != nil {
+		var constraintErr *data.ConstraintError
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
 	err = app.writeJSON(w, envelope{"user": user}, http.StatusOK, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
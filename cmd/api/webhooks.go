@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/WanderingAura/quotable/internal/webhook"
+)
+
+var webhookDeliverySortSafeList = []string{
+	"created_at",
+	"-created_at",
+}
+
+// queueEvent queues a job that creates deliveries of the event for the webhooks of the quote's
+// owner and, if the quote is listed, for admin webhooks. Passing the models of the transaction that
+// made the change means the event is only sent if the change is committed.
+func (app *application) queueEvent(models data.Models, event string, quote *data.Quote, eventData envelope) error {
+	payload, err := json.Marshal(envelope{
+		"event":       event,
+		"occurred_at": time.Now().UTC(),
+		"data":        eventData,
+	})
+	if err != nil {
+		return err
+	}
+
+	return app.enqueueJob(models, jobQueueWebhookEvent, queueWebhookEventJob{
+		Event:   event,
+		OwnerID: quote.UserID,
+		Listed:  quote.Listed(),
+		Payload: payload,
+	})
+}
+
+// queueCreatedEvent queues the quote.created event if the quote is listed. Quotes that aren't
+// listed yet are announced once they are, when they are published by the scheduler or made public,
+// so receivers never hear about quotes other users can't see.
+func (app *application) queueCreatedEvent(models data.Models, quote *data.Quote) error {
+	if !quote.Listed() {
+		return nil
+	}
+
+	// the owner's own reaction is only meant for them, not for the receivers of the event
+	eventQuote := *quote
+	eventQuote.MyReaction = nil
+	return app.queueEvent(models, data.EventQuoteCreated, quote, envelope{"quote": eventQuote})
+}
+
+// deliverWebhooks sends a batch of due webhook deliveries concurrently. Failed deliveries are
+// retried with exponential backoff until they have been tried webhook.MaxAttempts times, after
+// which they are dead-lettered and only retried if the webhook's owner asks for a redelivery.
+func (app *application) deliverWebhooks() error {
+	// a claimed delivery must not become due again while it is still being sent
+	lease := app.config.webhooks.timeout + time.Minute
+
+	deliveries, err := app.models.Webhooks.ClaimDue(app.config.webhooks.batchSize, lease)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			status, deliveryErr := app.webhooks.Send(context.Background(), webhook.Delivery{
+				ID:      delivery.ID,
+				URL:     delivery.URL,
+				Secret:  delivery.Secret,
+				Event:   delivery.Event,
+				Payload: delivery.Payload,
+			})
+
+			var retryAt *time.Time
+			if failures := delivery.Attempts + 1; deliveryErr != nil && failures < webhook.MaxAttempts {
+				next := time.Now().Add(webhook.Backoff(failures))
+				retryAt = &next
+			}
+
+			err := app.models.Webhooks.RecordAttempt(delivery.ID, status, deliveryErr, retryAt)
+			if err != nil {
+				app.logger.Error().Err(err).Int64("delivery_id", delivery.ID).Msg("failed to record webhook delivery attempt")
+			}
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL      string   `json:"url"`
+		Events   []string `json:"events"`
+		AllUsers bool     `json:"all_users"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	hook := &data.Webhook{
+		UserID:   user.ID,
+		URL:      input.URL,
+		Events:   input.Events,
+		AllUsers: input.AllUsers,
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, hook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// only admins may receive events about other users' quotes
+	if hook.AllUsers {
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include("quotes:admin") {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	err = app.models.Webhooks.Insert(hook)
+	if err != nil {
+		var constraintErr *data.ConstraintError
+		switch {
+		case errors.As(err, &constraintErr):
+			app.constraintViolationResponse(w, r, constraintErr)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"webhook": hook}, http.StatusCreated, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	webhooks, err := app.models.Webhooks.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"webhooks": webhooks}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamByName(r, "webhook_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Webhooks.Delete(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "webhook successfully deleted"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhookDeliveriesHandler is the delivery log of one of the user's webhooks
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamByName(r, "webhook_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input data.Filters
+	v := validator.New()
+	qs := r.URL.Query()
+
+	status := app.readString(qs, "status", "")
+	v.Check(status == "" || validator.In(status, data.DeliveryStatuses...), "status", "must be one of pending, delivered or dead")
+
+	input.Page = app.readInt(qs, "page", 1, v)
+	input.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sort = app.readString(qs, "sort", "-created_at")
+	input.SortSafeList = webhookDeliverySortSafeList
+
+	if data.ValidateFilters(v, input); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	hook, err := app.models.Webhooks.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	deliveries, metadata, err := app.models.Webhooks.GetDeliveries(hook.ID, status, input)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"deliveries": deliveries, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// redeliverWebhookHandler queues a dead-lettered delivery to be tried again
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readParamByName(r, "webhook_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	deliveryID, err := app.readParamByName(r, "delivery_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	hook, err := app.models.Webhooks.Get(id, user.ID)
+	if err == nil {
+		err = app.models.Webhooks.Redeliver(hook.ID, deliveryID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "delivery successfully queued"}, http.StatusAccepted, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	socketWriteWait    = 10 * time.Second
+	socketPongWait     = 60 * time.Second
+	socketPingInterval = 30 * time.Second
+	socketMaxMessage   = 4096
+	// how many quotes a single connection can watch at once
+	socketMaxQuotes = 100
+	// how many replies to client messages can be waiting to be written before the client is dropped
+	socketSendBuffer = 16
+)
+
+var socketUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// clients authenticate with a bearer token rather than a cookie, so a page on another origin
+	// can't open a socket as someone else and there's no need to restrict origins
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// socketRequest is a message sent by the client to change which quotes it is watching
+type socketRequest struct {
+	Action   string  `json:"action"`
+	QuoteIDs []int64 `json:"quote_ids"`
+}
+
+// reactionSocket is a client connected to GET /v1/live/reactions
+type reactionSocket struct {
+	app  *application
+	conn *websocket.Conn
+	user *data.User
+	sub  *streamSubscriber
+	// replies to client messages, written by the same goroutine as the count updates
+	send chan envelope
+	// the number of quotes being watched, only changed inside updateFilter so it's guarded by the
+	// broker's lock
+	watching int
+}
+
+// reactionSocketHandler upgrades the connection to a WebSocket that sends the like and dislike
+// counts of the quotes the client subscribes to whenever they change. Browsers can't set the
+// Authorization header on a WebSocket so the token can also be given in the access_token parameter.
+func (app *application) reactionSocketHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if token := r.URL.Query().Get("access_token"); user.IsAnonymous() && token != "" {
+		var err error
+		user, err = app.userForAuthToken(token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	if user.IsAnonymous() {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	// nothing is watched until the client subscribes to some quotes
+	sub, ok := app.stream.subscribe(streamFilter{
+		types:    []string{"quote.reacted", "quote.deleted"},
+		quoteIDs: map[int64]bool{},
+	})
+	if !ok {
+		app.errorResponse(w, r, http.StatusServiceUnavailable, "the server is shutting down")
+		return
+	}
+	defer app.stream.unsubscribe(sub)
+
+	// the upgrader has already sent an error response if this fails
+	conn, err := socketUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s := &reactionSocket{
+		app:  app,
+		conn: conn,
+		user: user,
+		sub:  sub,
+		send: make(chan envelope, socketSendBuffer),
+	}
+
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		s.readMessages()
+	}()
+
+	s.writeMessages(readerDone)
+
+	// closing the connection makes the reader return if it hasn't already
+	conn.Close()
+	<-readerDone
+}
+
+// readMessages handles subscribe and unsubscribe messages until the connection is closed
+func (s *reactionSocket) readMessages() {
+	s.conn.SetReadLimit(socketMaxMessage)
+	s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		_, message, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req socketRequest
+		err = json.Unmarshal(message, &req)
+		if err != nil {
+			if !s.reply(envelope{"type": "error", "error": "body contains badly-formed JSON"}) {
+				return
+			}
+			continue
+		}
+
+		v := validator.New()
+		v.Check(validator.In(req.Action, "subscribe", "unsubscribe"), "action", "must be subscribe or unsubscribe")
+		v.Check(len(req.QuoteIDs) > 0, "quote_ids", "must contain at least one quote ID")
+		v.Check(len(req.QuoteIDs) <= socketMaxQuotes, "quote_ids", "must not contain more than 100 quote IDs")
+		for _, id := range req.QuoteIDs {
+			v.Check(id > 0, "quote_ids", "must only contain positive integers")
+		}
+
+		if !v.Valid() {
+			if !s.reply(envelope{"type": "error", "error": v.Errors}) {
+				return
+			}
+			continue
+		}
+
+		var ok bool
+		switch req.Action {
+		case "subscribe":
+			ok = s.subscribe(req.QuoteIDs)
+		case "unsubscribe":
+			s.unsubscribe(req.QuoteIDs)
+			ok = true
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// subscribe starts watching the quotes and sends their current counts. Quotes are watched before
+// their counts are read so no change in between is missed, every message has the full counts so
+// the client can just keep the latest one.
+func (s *reactionSocket) subscribe(ids []int64) bool {
+	var added []int64
+	s.app.stream.updateFilter(s.sub, func(filter *streamFilter) {
+		for _, id := range ids {
+			if !filter.quoteIDs[id] && s.watching < socketMaxQuotes {
+				filter.quoteIDs[id] = true
+				s.watching++
+				added = append(added, id)
+			}
+		}
+	})
+
+	if len(added) < len(ids) && !s.reply(envelope{"type": "error", "error": "cannot watch more than 100 quotes at once"}) {
+		return false
+	}
+
+	for _, id := range added {
+		quote, err := s.app.models.Quotes.Get(id, s.user.ID)
+		if err != nil {
+			s.unsubscribe([]int64{id})
+
+			msg := envelope{"type": "error", "quote_id": id, "error": "the requested resource could not be found"}
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				s.app.logger.Error().Err(err).Int64("quote_id", id).Msg("failed to read reaction counts")
+				msg["error"] = "the server encountered a problem and could not process your request"
+			}
+			if !s.reply(msg) {
+				return false
+			}
+			continue
+		}
+
+		// count changes are only streamed for listed quotes, so others would never be updated
+		if !quote.Listed() {
+			s.unsubscribe([]int64{id})
+
+			if !s.reply(envelope{"type": "error", "quote_id": id, "error": "only public, published quotes can be watched"}) {
+				return false
+			}
+			continue
+		}
+
+		if !s.reply(envelope{"type": "counts", "quote_id": id, "likes": quote.Likes, "dislikes": quote.Dislikes}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *reactionSocket) unsubscribe(ids []int64) {
+	s.app.stream.updateFilter(s.sub, func(filter *streamFilter) {
+		for _, id := range ids {
+			if filter.quoteIDs[id] {
+				delete(filter.quoteIDs, id)
+				s.watching--
+			}
+		}
+	})
+}
+
+// reply queues a message for the client. It returns false and closes the connection if the client
+// isn't keeping up.
+func (s *reactionSocket) reply(msg envelope) bool {
+	select {
+	case s.send <- msg:
+		return true
+	default:
+		s.conn.Close()
+		return false
+	}
+}
+
+// writeMessages sends count updates, replies and pings until the client goes away or is dropped
+func (s *reactionSocket) writeMessages(readerDone <-chan struct{}) {
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+
+		select {
+		case <-readerDone:
+			return
+		case event, ok := <-s.sub.events:
+			if !ok {
+				s.close()
+				return
+			}
+			err = s.writeEvent(event)
+		case msg := <-s.send:
+			err = s.write(msg)
+		case <-ping.C:
+			err = s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait))
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *reactionSocket) writeEvent(event *data.StreamEvent) error {
+	// a quote that is no longer public can't be watched any more
+	if event.Type == "quote.deleted" {
+		s.unsubscribe([]int64{event.QuoteID})
+		return s.write(envelope{"type": "removed", "quote_id": event.QuoteID})
+	}
+
+	var counts struct {
+		Likes    int64 `json:"likes"`
+		Dislikes int64 `json:"dislikes"`
+	}
+	err := json.Unmarshal(event.Data, &counts)
+	if err != nil {
+		s.app.logger.Error().Err(err).Int64("event_id", event.ID).Msg("invalid reaction event")
+		return nil
+	}
+
+	return s.write(envelope{"type": "counts", "quote_id": event.QuoteID, "likes": counts.Likes, "dislikes": counts.Dislikes})
+}
+
+func (s *reactionSocket) write(msg envelope) error {
+	s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+	return s.conn.WriteJSON(msg)
+}
+
+// close tells the client why the broker stopped sending it updates
+func (s *reactionSocket) close() {
+	code, text := websocket.CloseTryAgainLater, "client is too slow"
+	select {
+	case <-s.app.stream.done:
+		code, text = websocket.CloseGoingAway, "the server is shutting down"
+	default:
+	}
+
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(socketWriteWait))
+}
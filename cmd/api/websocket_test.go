@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/data"
+	"github.com/gorilla/websocket"
+)
+
+// dialReactionSocket connects to the socket handler as the user without going through the token
+// lookup
+func dialReactionSocket(t *testing.T, app *application, user *data.User) *websocket.Conn {
+	t.Helper()
+
+	ts := mockServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.reactionSocketHandler(w, app.contextSetUser(r, user))
+	}))
+	t.Cleanup(ts.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	return conn
+}
+
+func TestReactionSocketRequiresAuthentication(t *testing.T) {
+	app := mockApp()
+	app.stream = newStreamBroker(app.logger, data.StreamEventDatabaseModel{})
+
+	ts := mockServer(app.routes())
+	defer ts.Close()
+
+	code, _, body := ts.get(t, "/v1/live/reactions")
+
+	assert.Equal(t, code, http.StatusUnauthorized)
+	assert.StringContains(t, body, "you must be authenticated")
+}
+
+func TestReactionSocketInvalidMessage(t *testing.T) {
+	app := mockApp()
+	app.stream = newStreamBroker(app.logger, data.StreamEventDatabaseModel{})
+	defer app.stream.Close()
+
+	conn := dialReactionSocket(t, app, &data.User{ID: 1})
+
+	err := conn.WriteJSON(envelope{"action": "watch", "quote_ids": []int64{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg struct {
+		Type  string            `json:"type"`
+		Error map[string]string `json:"error"`
+	}
+	err = conn.ReadJSON(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, msg.Type, "error")
+	assert.Equal(t, msg.Error["action"], "must be subscribe or unsubscribe")
+}
+
+func TestReactionSocketClosedOnShutdown(t *testing.T) {
+	app := mockApp()
+	app.stream = newStreamBroker(app.logger, data.StreamEventDatabaseModel{})
+
+	conn := dialReactionSocket(t, app, &data.User{ID: 1})
+
+	app.stream.Close()
+
+	_, _, err := conn.ReadMessage()
+	assert.Equal(t, websocket.IsCloseError(err, websocket.CloseGoingAway), true)
+}
+
+func TestReactionSocketSubscribeUnlisted(t *testing.T) {
+	app, db := newTestApp(t)
+	app.stream = newStreamBroker(app.logger, data.StreamEventDatabaseModel{})
+	defer app.stream.Close()
+
+	user := insertTestUser(t, db)
+	public := insertTestQuote(t, db, &data.Quote{UserID: user.ID})
+	private := insertTestQuote(t, db, &data.Quote{UserID: user.ID, Visibility: data.VisibilityPrivate})
+	draft := insertTestQuote(t, db, &data.Quote{UserID: user.ID, Status: data.StatusDraft})
+
+	conn := dialReactionSocket(t, app, user)
+
+	err := conn.WriteJSON(envelope{"action": "subscribe", "quote_ids": []int64{public.ID, private.ID, draft.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replies := make(map[int64]string)
+	for range 3 {
+		var msg struct {
+			Type    string `json:"type"`
+			QuoteID int64  `json:"quote_id"`
+		}
+		err = conn.ReadJSON(&msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replies[msg.QuoteID] = msg.Type
+	}
+
+	// the owner can see their own unlisted quotes but they are never streamed
+	assert.Equal(t, replies[public.ID], "counts")
+	assert.Equal(t, replies[private.ID], "error")
+	assert.Equal(t, replies[draft.ID], "error")
+}
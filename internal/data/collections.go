@@ -0,0 +1,333 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+// Collection is a named, ordered list of quotes put together by a user. Its visibility works the
+// same way as a quote's: public collections are listed on their owner's profile, unlisted ones can
+// only be fetched by ID and private ones are only shown to their owner.
+type Collection struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastModified time.Time `json:"last_modified"`
+	UserID       int64     `json:"user_id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Visibility   string    `json:"visibility"`
+	QuoteCount   int       `json:"quote_count"`
+	Version      int       `json:"version"`
+}
+
+type CollectionDatabaseModel struct {
+	DB DBTX
+}
+
+// collectionColumns returns the columns read into a Collection by scanDest. quote_count is computed
+// so it has to be selected from collections directly, and only counts the quotes that the user whose
+// ID is bound to the placeholder can see.
+func collectionColumns(placeholder string) string {
+	return fmt.Sprintf(`collections.id, collections.created_at, collections.last_modified,
+	collections.user_id, collections.name, collections.description, collections.visibility,
+	(SELECT count(*) FROM collection_quotes
+		INNER JOIN quotes ON quotes.id = collection_quotes.quote_id
+		WHERE collection_quotes.collection_id = collections.id AND %s),
+	collections.version`, viewableBy(placeholder))
+}
+
+// scanDest returns the scan destinations for collectionColumns
+func (c *Collection) scanDest() []interface{} {
+	return []interface{}{
+		&c.ID,
+		&c.CreatedAt,
+		&c.LastModified,
+		&c.UserID,
+		&c.Name,
+		&c.Description,
+		&c.Visibility,
+		&c.QuoteCount,
+		&c.Version,
+	}
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(utf8.RuneCountInString(collection.Name) <= 100, "name", "must not be more than 100 characters")
+	v.Check(validator.NoControlChars(collection.Name), "name", "must not contain control characters")
+
+	v.Check(utf8.RuneCountInString(collection.Description) < 500, "description", "must be less than 500 characters")
+	v.Check(validator.NoControlChars(collection.Description, '\n'), "description", "must not contain control characters")
+
+	v.Check(validator.In(collection.Visibility, Visibilities...), "visibility", "must be one of public, unlisted or private")
+}
+
+func (m *CollectionDatabaseModel) Insert(collection *Collection) error {
+	query := `
+		INSERT INTO collections (user_id, name, description, visibility)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, last_modified, version`
+
+	args := []interface{}{collection.UserID, collection.Name, collection.Description, collection.Visibility}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.LastModified,
+		&collection.Version,
+	)
+	return translateError(err)
+}
+
+// Get returns the collection with the given ID if the viewer is allowed to see it
+func (m *CollectionDatabaseModel) Get(id int64, viewerID int64) (*Collection, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM collections
+		WHERE collections.id = $1
+		AND (collections.user_id = $2 OR collections.visibility != 'private')`, collectionColumns("$2"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var collection Collection
+
+	err := m.DB.QueryRowContext(ctx, query, id, viewerID).Scan(collection.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &collection, nil
+}
+
+// GetAllForUser lists the user's collections that the viewer is allowed to see listed
+func (m *CollectionDatabaseModel) GetAllForUser(userID int64, viewerID int64, filters Filters) ([]*Collection, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM collections
+		WHERE collections.user_id = $1
+		AND (collections.user_id = $2 OR collections.visibility = 'public')
+		ORDER BY collections.%s %s, collections.id ASC
+		LIMIT $3 OFFSET $4`, collectionColumns("$2"), filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, viewerID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	collections := []*Collection{}
+
+	var totalRecords int
+
+	for rows.Next() {
+		var collection Collection
+		err := rows.Scan(append([]interface{}{&totalRecords}, collection.scanDest()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		collections = append(collections, &collection)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return collections, metadata, nil
+}
+
+func (m *CollectionDatabaseModel) Update(collection *Collection) error {
+	query := `
+		UPDATE collections
+		SET name = $1, description = $2, visibility = $3, version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING last_modified, version`
+
+	args := []interface{}{
+		collection.Name,
+		collection.Description,
+		collection.Visibility,
+		collection.ID,
+		collection.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.LastModified, &collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+func (m *CollectionDatabaseModel) Delete(id int64) error {
+	query := `
+		DELETE FROM collections WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// lockCollection locks the collection's row for the rest of the transaction so that changes to the
+// order of its quotes are made one at a time
+func lockCollection(ctx context.Context, tx DBTX, collectionID int64) error {
+	var id int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM collections WHERE id = $1 FOR UPDATE", collectionID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// AddQuote appends the quote to the end of the collection. Adding a quote that is already in the
+// collection returns ErrDuplicate.
+func (m *CollectionDatabaseModel) AddQuote(collectionID, quoteID int64) error {
+	query := `
+		INSERT INTO collection_quotes (collection_id, quote_id, position)
+		SELECT $1::bigint, $2::bigint, COALESCE(MAX(position), 0) + 1
+		FROM collection_quotes
+		WHERE collection_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx DBTX) error {
+		err := lockCollection(ctx, tx, collectionID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, query, collectionID, quoteID)
+		return translateError(err)
+	})
+}
+
+// RemoveQuote removes the quote from the collection. The collection_quotes_compact_trigger closes
+// the gap it leaves in the order.
+func (m *CollectionDatabaseModel) RemoveQuote(collectionID, quoteID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx DBTX) error {
+		err := lockCollection(ctx, tx, collectionID)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			DELETE FROM collection_quotes
+			WHERE collection_id = $1 AND quote_id = $2`, collectionID, quoteID)
+		if err != nil {
+			return err
+		}
+		numRows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if numRows == 0 {
+			return ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+// MoveQuote moves the quote to the given position in the collection, shifting the quotes in
+// between by one. Positions past the end of the collection move the quote to the end. This relies
+// on the positions running from 1 to the number of quotes, which collection_quotes_compact_trigger
+// keeps true when quotes are removed.
+func (m *CollectionDatabaseModel) MoveQuote(collectionID, quoteID int64, position int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return withTx(ctx, m.DB, func(tx DBTX) error {
+		err := lockCollection(ctx, tx, collectionID)
+		if err != nil {
+			return err
+		}
+
+		var current, count int
+		err = tx.QueryRowContext(ctx, `
+			SELECT position, (SELECT count(*) FROM collection_quotes WHERE collection_id = $1)
+			FROM collection_quotes
+			WHERE collection_id = $1 AND quote_id = $2`, collectionID, quoteID).Scan(&current, &count)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		position = min(position, count)
+		if position == current {
+			return nil
+		}
+
+		// make room at the new position by shifting the quotes between it and the old one
+		shift := `
+			UPDATE collection_quotes
+			SET position = position + 1
+			WHERE collection_id = $1 AND position >= $2 AND position < $3`
+		args := []interface{}{collectionID, position, current}
+		if position > current {
+			shift = `
+			UPDATE collection_quotes
+			SET position = position - 1
+			WHERE collection_id = $1 AND position > $2 AND position <= $3`
+			args = []interface{}{collectionID, current, position}
+		}
+
+		_, err = tx.ExecContext(ctx, shift, args...)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE collection_quotes
+			SET position = $3
+			WHERE collection_id = $1 AND quote_id = $2`, collectionID, quoteID, position)
+		return err
+	})
+}
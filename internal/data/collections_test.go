@@ -0,0 +1,169 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+// collectionOrder returns the IDs of the quotes in the collection in order, failing the test if
+// their positions don't run from 1 without gaps
+func collectionOrder(t *testing.T, db *sql.DB, collectionID int64) []int64 {
+	t.Helper()
+
+	rows, err := db.Query(`
+		SELECT quote_id, position FROM collection_quotes
+		WHERE collection_id = $1
+		ORDER BY position ASC`, collectionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var position int
+		err := rows.Scan(&id, &position)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, id)
+		if position != len(ids) {
+			t.Errorf("expected quote %d at position %d; got %d", id, len(ids), position)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return ids
+}
+
+func TestCollectionQuotes(t *testing.T) {
+	db := newTestDB(t)
+	collections := CollectionDatabaseModel{DB: db}
+	quotes := QuoteDatabaseModel{DB: db}
+
+	userID := insertTestUser(t, db)
+
+	collection := &Collection{UserID: userID, Name: "favourites", Visibility: VisibilityPublic}
+	err := collections.Insert(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]int64, 4)
+	for i := range ids {
+		ids[i] = insertTestQuote(t, db, userID)
+
+		err := collections.AddQuote(collection.ID, ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b, c, d := ids[0], ids[1], ids[2], ids[3]
+
+	assert.Equal(t, fmt.Sprint(collectionOrder(t, db, collection.ID)), fmt.Sprint([]int64{a, b, c, d}))
+
+	err = collections.AddQuote(collection.ID, a)
+	assert.Equal(t, errors.Is(err, ErrDuplicate), true)
+
+	err = collections.MoveQuote(collection.ID, c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fmt.Sprint(collectionOrder(t, db, collection.ID)), fmt.Sprint([]int64{c, a, b, d}))
+
+	err = collections.MoveQuote(collection.ID, c, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fmt.Sprint(collectionOrder(t, db, collection.ID)), fmt.Sprint([]int64{a, b, c, d}))
+
+	err = collections.RemoveQuote(collection.ID, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fmt.Sprint(collectionOrder(t, db, collection.ID)), fmt.Sprint([]int64{a, c, d}))
+
+	err = collections.RemoveQuote(collection.ID, b)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	// deleting a quote removes it from the collection without leaving a gap
+	err = quotes.Delete(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fmt.Sprint(collectionOrder(t, db, collection.ID)), fmt.Sprint([]int64{a, d}))
+
+	// so moves past the end and new quotes still go to the end
+	err = collections.MoveQuote(collection.ID, a, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fmt.Sprint(collectionOrder(t, db, collection.ID)), fmt.Sprint([]int64{d, a}))
+
+	err = collections.AddQuote(collection.ID, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fmt.Sprint(collectionOrder(t, db, collection.ID)), fmt.Sprint([]int64{d, a, b}))
+}
+
+func TestCollectionQuoteCount(t *testing.T) {
+	db := newTestDB(t)
+	collections := CollectionDatabaseModel{DB: db}
+
+	ownerID := insertTestUser(t, db)
+	viewerID := insertTestUser(t, db)
+
+	collection := &Collection{UserID: ownerID, Name: "mixed", Visibility: VisibilityPublic}
+	err := collections.Insert(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, quote := range []*Quote{
+		{UserID: ownerID},
+		{UserID: ownerID, Visibility: VisibilityUnlisted},
+		{UserID: ownerID, Visibility: VisibilityPrivate},
+		{UserID: ownerID, Status: StatusDraft},
+	} {
+		err := collections.AddQuote(collection.ID, insertTestQuoteWith(t, db, quote))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		viewerID int64
+		want     int
+	}{
+		{"Owner", ownerID, 4},
+		{"Other user", viewerID, 2},
+		{"Anonymous", 0, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := collections.Get(collection.ID, tt.viewerID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, got.QuoteCount, tt.want)
+
+			listed, _, err := collections.GetAllForUser(ownerID, tt.viewerID, Filters{Page: 1, PageSize: 20, Sort: "id", SortSafeList: []string{"id"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, len(listed), 1)
+			assert.Equal(t, listed[0].QuoteCount, tt.want)
+		})
+	}
+}
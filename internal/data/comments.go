@@ -0,0 +1,245 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidParent is returned when a reply is made to a comment that is on a different quote or
+// is itself a reply
+var ErrInvalidParent = errors.New("invalid parent comment")
+
+// Comment is a comment on a quote. Top-level comments have no ParentID and can have replies, which
+// are only filled in when listing a quote's comments.
+type Comment struct {
+	ID           int64      `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastModified time.Time  `json:"last_modified"`
+	QuoteID      int64      `json:"quote_id"`
+	UserID       int64      `json:"user_id"`
+	ParentID     *int64     `json:"parent_id,omitempty"`
+	Body         string     `json:"body"`
+	Version      int        `json:"version"`
+	Replies      []*Comment `json:"replies,omitempty"`
+}
+
+type CommentDatabaseModel struct {
+	DB DBTX
+}
+
+const commentColumns = `id, created_at, last_modified, quote_id, user_id, parent_id, body, version`
+
+// scanDest returns the scan destinations for commentColumns
+func (c *Comment) scanDest() []interface{} {
+	return []interface{}{
+		&c.ID,
+		&c.CreatedAt,
+		&c.LastModified,
+		&c.QuoteID,
+		&c.UserID,
+		&c.ParentID,
+		&c.Body,
+		&c.Version,
+	}
+}
+
+func NormaliseComment(comment *Comment) {
+	comment.Body = normaliseText(comment.Body)
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Body != "", "body", "must be provided")
+	v.Check(utf8.RuneCountInString(comment.Body) <= 2000, "body", "must not be more than 2000 characters")
+	v.Check(validator.NoControlChars(comment.Body, '\n'), "body", "must not contain control characters")
+}
+
+// Insert adds the comment. Replies must be to a top-level comment on the same quote, otherwise
+// ErrInvalidParent is returned.
+func (m *CommentDatabaseModel) Insert(comment *Comment) error {
+	query := `
+		INSERT INTO comments (quote_id, user_id, parent_id, body)
+		SELECT $1::bigint, $2::bigint, $3::bigint, $4::text
+		WHERE $3::bigint IS NULL OR EXISTS (
+			SELECT 1 FROM comments WHERE id = $3 AND quote_id = $1 AND parent_id IS NULL
+		)
+		RETURNING id, created_at, last_modified, version`
+
+	args := []interface{}{comment.QuoteID, comment.UserID, comment.ParentID, comment.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.LastModified,
+		&comment.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrInvalidParent
+		default:
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+func (m *CommentDatabaseModel) Get(id int64) (*Comment, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM comments
+		WHERE id = $1`, commentColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var comment Comment
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(comment.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &comment, nil
+}
+
+// GetAllForQuote returns a page of the quote's top-level comments, each with all of its replies
+// in the order they were made
+func (m *CommentDatabaseModel) GetAllForQuote(quoteID int64, filters Filters) ([]*Comment, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM comments
+		WHERE quote_id = $1 AND parent_id IS NULL
+		ORDER BY %s %s, id %s
+		LIMIT $2 OFFSET $3`, commentColumns, filters.sortColumn(), filters.sortDirection(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, quoteID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	comments := []*Comment{}
+	byID := make(map[int64]*Comment)
+	parentIDs := []int64{}
+
+	var totalRecords int
+
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(append([]interface{}{&totalRecords}, comment.scanDest()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		comments = append(comments, &comment)
+		byID[comment.ID] = &comment
+		parentIDs = append(parentIDs, comment.ID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if len(parentIDs) > 0 {
+		err = m.addReplies(ctx, parentIDs, byID)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return comments, metadata, nil
+}
+
+// addReplies fetches the replies to the given comments and appends them to their parent in byID
+func (m *CommentDatabaseModel) addReplies(ctx context.Context, parentIDs []int64, byID map[int64]*Comment) error {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM comments
+		WHERE parent_id = ANY($1)
+		ORDER BY created_at ASC, id ASC`, commentColumns)
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(parentIDs))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var reply Comment
+		err := rows.Scan(reply.scanDest()...)
+		if err != nil {
+			return err
+		}
+
+		parent := byID[*reply.ParentID]
+		parent.Replies = append(parent.Replies, &reply)
+	}
+
+	return rows.Err()
+}
+
+func (m *CommentDatabaseModel) Update(comment *Comment) error {
+	query := `
+		UPDATE comments
+		SET body = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING last_modified, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, comment.Body, comment.ID, comment.Version).Scan(&comment.LastModified, &comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// Delete removes the comment along with any replies to it
+func (m *CommentDatabaseModel) Delete(id int64) error {
+	query := `
+		DELETE FROM comments WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
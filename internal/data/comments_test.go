@@ -0,0 +1,118 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+// commentCount returns the quote's comment_count as kept by the sync_comment_count trigger
+func commentCount(t *testing.T, db *sql.DB, quoteID int64) int64 {
+	t.Helper()
+
+	var count int64
+	err := db.QueryRow("SELECT comment_count FROM quotes WHERE id = $1", quoteID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestCommentReplies(t *testing.T) {
+	db := newTestDB(t)
+	comments := CommentDatabaseModel{DB: db}
+
+	userID := insertTestUser(t, db)
+	quoteID := insertTestQuote(t, db, userID)
+	otherQuoteID := insertTestQuote(t, db, userID)
+
+	parent := &Comment{QuoteID: quoteID, UserID: userID, Body: "parent"}
+	err := comments.Insert(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := &Comment{QuoteID: quoteID, UserID: userID, ParentID: &parent.ID, Body: "reply"}
+	err = comments.Insert(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		quoteID  int64
+		parentID int64
+	}{
+		{"Reply to a reply", quoteID, reply.ID},
+		{"Reply to a comment on another quote", otherQuoteID, parent.ID},
+		{"Reply to a missing comment", quoteID, reply.ID + 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := comments.Insert(&Comment{QuoteID: tt.quoteID, UserID: userID, ParentID: &tt.parentID, Body: "nested"})
+			if !errors.Is(err, ErrInvalidParent) {
+				t.Errorf("expected ErrInvalidParent; got %v", err)
+			}
+		})
+	}
+
+	listed, _, err := comments.GetAllForQuote(quoteID, Filters{Page: 1, PageSize: 20, Sort: "created_at", SortSafeList: []string{"created_at"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(listed), 1)
+	assert.Equal(t, listed[0].ID, parent.ID)
+	assert.Equal(t, len(listed[0].Replies), 1)
+	assert.Equal(t, listed[0].Replies[0].ID, reply.ID)
+	assert.Equal(t, commentCount(t, db, otherQuoteID), int64(0))
+}
+
+func TestCommentCount(t *testing.T) {
+	db := newTestDB(t)
+	comments := CommentDatabaseModel{DB: db}
+
+	userID := insertTestUser(t, db)
+	quoteID := insertTestQuote(t, db, userID)
+
+	parent := &Comment{QuoteID: quoteID, UserID: userID, Body: "parent"}
+	err := comments.Insert(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"first", "second"} {
+		err = comments.Insert(&Comment{QuoteID: quoteID, UserID: userID, ParentID: &parent.ID, Body: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// replies are counted as well
+	assert.Equal(t, commentCount(t, db, quoteID), int64(3))
+
+	// deleting the parent deletes its replies with it and the count follows
+	err = comments.Delete(parent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, commentCount(t, db, quoteID), int64(0))
+
+	err = comments.Delete(parent.ID)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound; got %v", err)
+	}
+}
+
+func TestNormaliseComment(t *testing.T) {
+	// "e" followed by a combining acute accent
+	comment := Comment{Body: "  Cafe\u0301 society  \n"}
+
+	NormaliseComment(&comment)
+
+	assert.Equal(t, comment.Body, "Caf\u00e9 society")
+}
@@ -0,0 +1,243 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/lib/pq"
+)
+
+// How often digests can be sent. They must match digest_preferences_frequency_check.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+var DigestFrequencies = []string{DigestDaily, DigestWeekly}
+
+// DigestHour is the hour of the day, in the user's time zone, that digests are sent at. Weekly
+// digests are sent on Mondays.
+const DigestHour = 8
+
+// DigestPreferences are the settings for a user's email digest of popular quotes. Quotes with any
+// of the tags are included, or quotes with any tags if there are none.
+type DigestPreferences struct {
+	UserID     int64      `json:"-"`
+	Enabled    bool       `json:"enabled"`
+	Tags       []string   `json:"tags"`
+	Frequency  string     `json:"frequency"`
+	Timezone   string     `json:"timezone"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	NextSendAt *time.Time `json:"next_send_at"`
+}
+
+// DefaultDigestPreferences are used for users who haven't set any
+func DefaultDigestPreferences(userID int64) *DigestPreferences {
+	return &DigestPreferences{
+		UserID:    userID,
+		Tags:      []string{},
+		Frequency: DigestWeekly,
+		Timezone:  "UTC",
+	}
+}
+
+func NormaliseDigestPreferences(preferences *DigestPreferences) {
+	for i := range preferences.Tags {
+		preferences.Tags[i] = normaliseText(preferences.Tags[i])
+	}
+}
+
+func ValidateDigestPreferences(v *validator.Validator, preferences *DigestPreferences) {
+	v.Check(validator.In(preferences.Frequency, DigestFrequencies...), "frequency", "must be daily or weekly")
+
+	// "Local" would make the send time depend on the server's configuration
+	_, err := time.LoadLocation(preferences.Timezone)
+	v.Check(err == nil && preferences.Timezone != "Local", "timezone", "must be a valid IANA time zone name")
+
+	v.Check(preferences.Tags != nil, "tags", "must be provided")
+	v.Check(len(preferences.Tags) <= 10, "tags", "must not contain more than 10 tags")
+
+	for _, tag := range preferences.Tags {
+		v.Check(tag != "", "tags", "must not contain empty values")
+		v.Check(validator.NoControlChars(tag), "tags", "must not contain control characters")
+	}
+
+	v.Check(validator.Unique(preferences.Tags), "tags", "must not contain duplicate values")
+}
+
+// NextDigestTime returns when the next digest after the given time should be sent: the next
+// DigestHour in the time zone for daily digests, and the next Monday at DigestHour for weekly ones
+func NextDigestTime(after time.Time, frequency string, location *time.Location) time.Time {
+	local := after.In(location)
+	next := time.Date(local.Year(), local.Month(), local.Day(), DigestHour, 0, 0, 0, location)
+
+	switch frequency {
+	case DigestWeekly:
+		// days until Monday, going forward a week if it's Monday but the hour has passed
+		next = next.AddDate(0, 0, (int(time.Monday)-int(next.Weekday())+7)%7)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+	default:
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 1)
+		}
+	}
+
+	return next
+}
+
+// DigestPeriod returns how far back a digest looks for quotes when it has never been sent before
+func DigestPeriod(frequency string) time.Duration {
+	if frequency == DigestDaily {
+		return 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+type DigestDatabaseModel struct {
+	DB DBTX
+}
+
+const digestColumns = `user_id, enabled, tags, frequency, timezone, last_sent_at, next_send_at`
+
+func (p *DigestPreferences) scanDest() []interface{} {
+	return []interface{}{
+		&p.UserID,
+		&p.Enabled,
+		pq.Array(&p.Tags),
+		&p.Frequency,
+		&p.Timezone,
+		&p.LastSentAt,
+		&p.NextSendAt,
+	}
+}
+
+// GetPreferences returns the user's digest preferences, or the defaults if they haven't set any
+func (m *DigestDatabaseModel) GetPreferences(userID int64) (*DigestPreferences, error) {
+	query := `
+		SELECT ` + digestColumns + `
+		FROM digest_preferences
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var preferences DigestPreferences
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(preferences.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return DefaultDigestPreferences(userID), nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &preferences, nil
+}
+
+// SetPreferences stores the preferences and schedules the next digest if they are enabled
+func (m *DigestDatabaseModel) SetPreferences(preferences *DigestPreferences) error {
+	preferences.NextSendAt = nil
+	if preferences.Enabled {
+		location, err := time.LoadLocation(preferences.Timezone)
+		if err != nil {
+			return err
+		}
+		next := NextDigestTime(time.Now(), preferences.Frequency, location)
+		preferences.NextSendAt = &next
+	}
+
+	query := `
+		INSERT INTO digest_preferences (user_id, enabled, tags, frequency, timezone, next_send_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET enabled = EXCLUDED.enabled, tags = EXCLUDED.tags, frequency = EXCLUDED.frequency,
+			timezone = EXCLUDED.timezone, next_send_at = EXCLUDED.next_send_at
+		RETURNING last_sent_at`
+
+	args := []interface{}{
+		preferences.UserID,
+		preferences.Enabled,
+		pq.Array(preferences.Tags),
+		preferences.Frequency,
+		preferences.Timezone,
+		preferences.NextSendAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&preferences.LastSentAt)
+	return translateError(err)
+}
+
+// Disable turns off the user's digests, keeping the rest of their preferences
+func (m *DigestDatabaseModel) Disable(userID int64) error {
+	query := `
+		UPDATE digest_preferences
+		SET enabled = false, next_send_at = NULL
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// ClaimDue locks up to limit enabled preferences whose next digest is due. It has to be run in a
+// transaction, which holds the locks until MarkQueued has been called for each of them so that
+// other instances skip them.
+func (m *DigestDatabaseModel) ClaimDue(limit int) ([]*DigestPreferences, error) {
+	query := `
+		SELECT ` + digestColumns + `
+		FROM digest_preferences
+		WHERE enabled AND next_send_at <= NOW()
+		ORDER BY next_send_at ASC
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	due := []*DigestPreferences{}
+
+	for rows.Next() {
+		var preferences DigestPreferences
+		err := rows.Scan(preferences.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+
+		due = append(due, &preferences)
+	}
+
+	return due, rows.Err()
+}
+
+// MarkQueued records that the user's digest has been queued and when the next one is due
+func (m *DigestDatabaseModel) MarkQueued(userID int64, next time.Time) error {
+	query := `
+		UPDATE digest_preferences
+		SET last_sent_at = NOW(), next_send_at = $2
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, next)
+	return err
+}
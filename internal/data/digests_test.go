@@ -0,0 +1,115 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+func TestNextDigestTime(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	tests := []struct {
+		name      string
+		after     time.Time
+		frequency string
+		location  *time.Location
+		want      time.Time
+	}{
+		{
+			name:      "daily before the hour",
+			after:     time.Date(2024, 3, 6, 7, 59, 0, 0, london),
+			frequency: DigestDaily,
+			location:  london,
+			want:      time.Date(2024, 3, 6, 8, 0, 0, 0, london),
+		},
+		{
+			name:      "daily on the hour",
+			after:     time.Date(2024, 3, 6, 8, 0, 0, 0, london),
+			frequency: DigestDaily,
+			location:  london,
+			want:      time.Date(2024, 3, 7, 8, 0, 0, 0, london),
+		},
+		{
+			// the clocks go forward on the 31st, the digest is still sent at 8 local time
+			name:      "daily across daylight saving",
+			after:     time.Date(2024, 3, 30, 9, 0, 0, 0, london),
+			frequency: DigestDaily,
+			location:  london,
+			want:      time.Date(2024, 3, 31, 8, 0, 0, 0, london),
+		},
+		{
+			name:      "weekly midweek",
+			after:     time.Date(2024, 3, 6, 12, 0, 0, 0, london),
+			frequency: DigestWeekly,
+			location:  london,
+			want:      time.Date(2024, 3, 11, 8, 0, 0, 0, london),
+		},
+		{
+			name:      "weekly on Monday before the hour",
+			after:     time.Date(2024, 3, 11, 7, 0, 0, 0, london),
+			frequency: DigestWeekly,
+			location:  london,
+			want:      time.Date(2024, 3, 11, 8, 0, 0, 0, london),
+		},
+		{
+			name:      "weekly on Monday after the hour",
+			after:     time.Date(2024, 3, 11, 9, 0, 0, 0, london),
+			frequency: DigestWeekly,
+			location:  london,
+			want:      time.Date(2024, 3, 18, 8, 0, 0, 0, london),
+		},
+		{
+			// Sunday evening in UTC is already Monday morning in Tokyo
+			name:      "weekly in another time zone",
+			after:     time.Date(2024, 3, 10, 22, 0, 0, 0, time.UTC),
+			frequency: DigestWeekly,
+			location:  tokyo,
+			want:      time.Date(2024, 3, 11, 8, 0, 0, 0, tokyo),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := NextDigestTime(test.after, test.frequency, test.location)
+			assert.Equal(t, got.Equal(test.want), true)
+		})
+	}
+}
+
+func TestValidateDigestPreferences(t *testing.T) {
+	tests := []struct {
+		name        string
+		preferences DigestPreferences
+		field       string
+	}{
+		{name: "valid", preferences: DigestPreferences{Tags: []string{"life"}, Frequency: DigestDaily, Timezone: "Europe/Paris"}},
+		{name: "monthly", preferences: DigestPreferences{Tags: []string{}, Frequency: "monthly", Timezone: "UTC"}, field: "frequency"},
+		{name: "unknown time zone", preferences: DigestPreferences{Tags: []string{}, Frequency: DigestWeekly, Timezone: "Mars/Olympus"}, field: "timezone"},
+		{name: "server time zone", preferences: DigestPreferences{Tags: []string{}, Frequency: DigestWeekly, Timezone: "Local"}, field: "timezone"},
+		{name: "duplicate tags", preferences: DigestPreferences{Tags: []string{"life", "life"}, Frequency: DigestWeekly, Timezone: "UTC"}, field: "tags"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateDigestPreferences(v, &test.preferences)
+
+			if test.field == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			_, hasErr := v.Errors[test.field]
+			assert.Equal(t, hasErr, true)
+		})
+	}
+}
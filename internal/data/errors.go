@@ -0,0 +1,139 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicate           = errors.New("duplicate value")
+	ErrCheckViolation      = errors.New("check constraint violation")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+)
+
+// ConstraintError is returned by the models when a write is rejected by a database constraint.
+// It unwraps to ErrDuplicate, ErrCheckViolation or ErrForeignKeyViolation.
+type ConstraintError struct {
+	Err        error
+	Constraint string
+	// the input field the constraint applies to, empty if it doesn't map to a single field
+	Field   string
+	Message string
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.Constraint)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+type constraintField struct {
+	field   string
+	message string
+}
+
+// maps the named constraints from the migrations to the input field they apply to
+var constraintFields = map[string]constraintField{
+	"users_email_key":    {"email", "there is already a registered user with that email"},
+	"users_locale_check": {"locale", "must be a language tag such as en or pt-br"},
+
+	"quotes_content_check":           {"content", "must be less than 300 characters"},
+	"quotes_author_check":            {"author", "must be less than 100 characters"},
+	"quotes_source_title_check":      {"source", "title must be less than 300 characters"},
+	"quotes_source_type_title_check": {"source", "type must be less than 300 characters"},
+	"quotes_tags_length_check":       {"tags", "must not contain more than 10 tags"},
+	"quotes_visibility_check":        {"visibility", "must be one of public, unlisted or private"},
+	"quotes_status_check":            {"status", "must be one of draft, scheduled or published"},
+	"quotes_publish_at_check":        {"publish_at", "must be provided for scheduled quotes"},
+	"quotes_user_id_fkey":            {"user_id", "must refer to an existing user"},
+
+	"tokens_user_id_fkey": {"user_id", "must refer to an existing user"},
+
+	"users_permissions_pkey":               {"permissions", "the user already has that permission"},
+	"users_permissions_user_id_fkey":       {"user_id", "must refer to an existing user"},
+	"users_permissions_permission_id_fkey": {"permissions", "must refer to an existing permission"},
+
+	"likes_user_id_fkey":  {"user_id", "must refer to an existing user"},
+	"likes_quote_id_fkey": {"quote_id", "must refer to an existing quote"},
+	"likes_val_fkey":      {"reaction", "must be a known reaction"},
+
+	"collections_name_check":               {"name", "must be between 1 and 100 characters"},
+	"collections_description_check":        {"description", "must be less than 500 characters"},
+	"collections_visibility_check":         {"visibility", "must be one of public, unlisted or private"},
+	"collections_user_id_name_key":         {"name", "you already have a collection with that name"},
+	"collections_user_id_fkey":             {"user_id", "must refer to an existing user"},
+	"collection_quotes_pkey":               {"quote_id", "the quote is already in the collection"},
+	"collection_quotes_collection_id_fkey": {"collection_id", "must refer to an existing collection"},
+	"collection_quotes_quote_id_fkey":      {"quote_id", "must refer to an existing quote"},
+
+	"comments_body_check":     {"body", "must be between 1 and 2000 characters"},
+	"comments_quote_id_fkey":  {"quote_id", "must refer to an existing quote"},
+	"comments_user_id_fkey":   {"user_id", "must refer to an existing user"},
+	"comments_parent_id_fkey": {"parent_id", "must refer to an existing comment"},
+
+	"follows_self_check":       {"user_id", "you can't follow yourself"},
+	"follows_follower_id_fkey": {"user_id", "must refer to an existing user"},
+	"follows_followee_id_fkey": {"user_id", "must refer to an existing user"},
+
+	"notifications_type_check":            {"type", "must be one of reaction, comment, reply, follow or saved_search"},
+	"notification_preferences_type_check": {"preferences", "must only contain reaction, comment, reply, follow or saved_search"},
+
+	"digest_preferences_frequency_check": {"frequency", "must be daily or weekly"},
+	"digest_preferences_tags_check":      {"tags", "must not contain more than 10 tags"},
+
+	"saved_searches_name_check":          {"name", "must be between 1 and 100 characters"},
+	"saved_searches_content_check":       {"content", "must be less than 300 characters"},
+	"saved_searches_author_check":        {"author", "must be less than 100 characters"},
+	"saved_searches_tags_check":          {"tags", "must not contain more than 10 tags"},
+	"saved_searches_alert_check":         {"alert", "must be one of in_app, email or none"},
+	"saved_searches_user_id_name_key":    {"name", "you already have a saved search with that name"},
+	"saved_searches_user_id_fkey":        {"user_id", "must refer to an existing user"},
+	"saved_search_matches_quote_id_fkey": {"quote_id", "must refer to an existing quote"},
+
+	"review_cards_user_id_fkey":  {"user_id", "must refer to an existing user"},
+	"review_cards_quote_id_fkey": {"quote_id", "must refer to an existing quote"},
+
+	"notes_body_check":    {"body", "must be between 1 and 5000 characters"},
+	"notes_user_id_fkey":  {"user_id", "must refer to an existing user"},
+	"notes_quote_id_fkey": {"quote_id", "must refer to an existing quote"},
+
+	"webhooks_url_check":    {"url", "must be less than 2000 bytes"},
+	"webhooks_events_check": {"events", "must only contain quote.created, quote.updated, quote.deleted or quote.reacted"},
+	"webhooks_user_id_fkey": {"user_id", "must refer to an existing user"},
+}
+
+// translateError converts postgres constraint violations into a *ConstraintError. Any other
+// error is returned unchanged so it is safe to call on every error returned by the driver.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	constraintErr := &ConstraintError{Constraint: pqErr.Constraint}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		constraintErr.Err = ErrDuplicate
+		constraintErr.Message = "conflicts with an existing record"
+	case "check_violation":
+		constraintErr.Err = ErrCheckViolation
+		constraintErr.Message = "contains an invalid value"
+	case "foreign_key_violation":
+		constraintErr.Err = ErrForeignKeyViolation
+		constraintErr.Message = "refers to a record that does not exist"
+	default:
+		return err
+	}
+
+	if cf, ok := constraintFields[pqErr.Constraint]; ok {
+		constraintErr.Field = cf.field
+		constraintErr.Message = cf.message
+	}
+
+	return constraintErr
+}
@@ -0,0 +1,60 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/lib/pq"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+		field    string
+	}{
+		{
+			name:     "duplicate email",
+			err:      &pq.Error{Code: "23505", Constraint: "users_email_key"},
+			expected: ErrDuplicate,
+			field:    "email",
+		},
+		{
+			name:     "content too long",
+			err:      &pq.Error{Code: "23514", Constraint: "quotes_content_check"},
+			expected: ErrCheckViolation,
+			field:    "content",
+		},
+		{
+			name:     "missing quote",
+			err:      &pq.Error{Code: "23503", Constraint: "likes_quote_id_fkey"},
+			expected: ErrForeignKeyViolation,
+			field:    "quote_id",
+		},
+		{
+			name:     "unknown constraint",
+			err:      &pq.Error{Code: "23505", Constraint: "some_other_key"},
+			expected: ErrDuplicate,
+			field:    "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := translateError(test.err)
+			assert.Equal(t, errors.Is(err, test.expected), true)
+
+			var constraintErr *ConstraintError
+			assert.Equal(t, errors.As(err, &constraintErr), true)
+			assert.Equal(t, constraintErr.Field, test.field)
+		})
+	}
+
+	t.Run("other errors are unchanged", func(t *testing.T) {
+		other := &pq.Error{Code: "40001"}
+		assert.Equal(t, translateError(other), error(other))
+		assert.Equal(t, translateError(nil), nil)
+	})
+}
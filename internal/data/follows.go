@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Follow is an entry in a list of followers or followed users
+type Follow struct {
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type FollowDatabaseModel struct {
+	DB DBTX
+}
+
+// Insert makes the follower follow the followee. Following someone twice is not an error.
+func (m *FollowDatabaseModel) Insert(followerID, followeeID int64) error {
+	query := `
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, followerID, followeeID)
+	return translateError(err)
+}
+
+// Delete makes the follower stop following the followee. It isn't an error if they weren't.
+func (m *FollowDatabaseModel) Delete(followerID, followeeID int64) error {
+	query := `
+		DELETE FROM follows
+		WHERE follower_id = $1 AND followee_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, followerID, followeeID)
+	return err
+}
+
+// GetFollowers lists the users following the user
+func (m *FollowDatabaseModel) GetFollowers(userID int64, filters Filters) ([]*Follow, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), users.id, users.username, follows.created_at
+		FROM follows
+		INNER JOIN users ON users.id = follows.follower_id
+		WHERE follows.followee_id = $1
+		ORDER BY follows.created_at %s, users.id %s
+		LIMIT $2 OFFSET $3`, filters.sortDirection(), filters.sortDirection())
+
+	return m.list(query, userID, filters)
+}
+
+// GetFollowing lists the users that the user follows
+func (m *FollowDatabaseModel) GetFollowing(userID int64, filters Filters) ([]*Follow, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), users.id, users.username, follows.created_at
+		FROM follows
+		INNER JOIN users ON users.id = follows.followee_id
+		WHERE follows.follower_id = $1
+		ORDER BY follows.created_at %s, users.id %s
+		LIMIT $2 OFFSET $3`, filters.sortDirection(), filters.sortDirection())
+
+	return m.list(query, userID, filters)
+}
+
+func (m *FollowDatabaseModel) list(query string, userID int64, filters Filters) ([]*Follow, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	follows := []*Follow{}
+
+	var totalRecords int
+
+	for rows.Next() {
+		var follow Follow
+		err := rows.Scan(&totalRecords, &follow.UserID, &follow.Username, &follow.FollowedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		follows = append(follows, &follow)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return follows, metadata, nil
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrLeaseExpired is returned when finishing a job whose lease ran out, so another worker may have
+// claimed it since
+var ErrLeaseExpired = errors.New("job lease expired")
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDead    = "dead"
+)
+
+// Job is a unit of background work stored in the database so that it survives restarts. Jobs are
+// run at least once, so running the same job twice must be harmless.
+type Job struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+type JobDatabaseModel struct {
+	DB DBTX
+}
+
+// Insert queues the job to be run once its RunAt time has passed
+func (m *JobDatabaseModel) Insert(job *Job) error {
+	query := `
+		INSERT INTO jobs (type, payload, max_attempts, run_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, status`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, job.Type, job.Payload, job.MaxAttempts, job.RunAt).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.Status,
+	)
+}
+
+// Claim takes the next due job and counts the attempt. Nobody else can claim it until the lease has
+// passed, after which it is assumed the worker running it has died. Abandoned jobs that have no
+// attempts left are marked dead instead, so a job that kills its worker isn't retried forever.
+// ErrRecordNotFound is returned if no job is due.
+func (m *JobDatabaseModel) Claim(lease time.Duration) (*Job, error) {
+	query := `
+		WITH abandoned AS (
+			UPDATE jobs
+			SET status = 'dead', locked_until = NULL, last_error = 'lease expired on the last attempt'
+			WHERE status = 'running' AND locked_until <= NOW() AND attempts >= max_attempts
+		)
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1,
+			locked_until = NOW() + $1::float8 * interval '1 second'
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = 'pending' AND run_at <= NOW())
+			OR (status = 'running' AND locked_until <= NOW() AND attempts < max_attempts)
+			ORDER BY run_at ASC
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, created_at, type, payload, status, attempts, max_attempts, run_at, last_error`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job Job
+	err := m.DB.QueryRowContext(ctx, query, lease.Seconds()).Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.Type,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// Complete removes a job that has run successfully. Every claim counts an attempt, so the attempts
+// of the claimed job identify the claim: if the job has been claimed again since, ErrLeaseExpired is
+// returned and the job is left to the worker that has it now.
+func (m *JobDatabaseModel) Complete(job *Job) error {
+	query := `
+		DELETE FROM jobs
+		WHERE id = $1 AND status = 'running' AND attempts = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, job.ID, job.Attempts)
+	if err != nil {
+		return err
+	}
+
+	return leaseHeld(res)
+}
+
+// Fail records why the job failed. It is run again at retryAt, or marked dead if retryAt is nil.
+// Like Complete it returns ErrLeaseExpired if the job has been claimed again since.
+func (m *JobDatabaseModel) Fail(job *Job, jobErr error, retryAt *time.Time) error {
+	status := JobPending
+	if retryAt == nil {
+		status = JobDead
+	}
+
+	query := `
+		UPDATE jobs
+		SET status = $3, run_at = COALESCE($4, run_at), locked_until = NULL, last_error = $5
+		WHERE id = $1 AND status = 'running' AND attempts = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, job.ID, job.Attempts, status, retryAt, jobErr.Error())
+	if err != nil {
+		return err
+	}
+
+	return leaseHeld(res)
+}
+
+// leaseHeld returns ErrLeaseExpired if finishing a job didn't change it
+func leaseHeld(res sql.Result) error {
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrLeaseExpired
+	}
+	return nil
+}
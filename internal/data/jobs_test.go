@@ -0,0 +1,137 @@
+package data
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+func TestJobLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	jobs := JobDatabaseModel{DB: db}
+
+	job := &Job{
+		Type:        "test",
+		Payload:     []byte(`{}`),
+		MaxAttempts: 2,
+		RunAt:       time.Now().Add(-time.Minute),
+	}
+	err := jobs.Insert(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM jobs WHERE id = $1", job.ID) })
+
+	claimed, err := jobs.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, claimed.ID, job.ID)
+	assert.Equal(t, claimed.Attempts, 1)
+
+	// a claimed job isn't handed to anyone else while its lease lasts
+	_, err = jobs.Claim(time.Minute)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	retryAt := time.Now().Add(time.Hour)
+	err = jobs.Fail(claimed, errors.New("try again"), &retryAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nor is a failed job before its retry time
+	_, err = jobs.Claim(time.Minute)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	var status, lastError string
+	err = db.QueryRow("SELECT status, last_error FROM jobs WHERE id = $1", job.ID).Scan(&status, &lastError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, status, JobPending)
+	assert.Equal(t, lastError, "try again")
+
+	// the claim ended when the job failed
+	err = jobs.Complete(claimed)
+	assert.Equal(t, errors.Is(err, ErrLeaseExpired), true)
+
+	_, err = db.Exec("UPDATE jobs SET run_at = NOW() WHERE id = $1", job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reclaimed, err := jobs.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reclaimed.Attempts, 2)
+
+	err = jobs.Complete(reclaimed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.QueryRow("SELECT status FROM jobs WHERE id = $1", job.ID).Scan(&status)
+	assert.Equal(t, errors.Is(err, sql.ErrNoRows), true)
+}
+
+func TestJobLeaseExpiry(t *testing.T) {
+	db := newTestDB(t)
+	jobs := JobDatabaseModel{DB: db}
+
+	job := &Job{
+		Type:        "test",
+		Payload:     []byte(`{}`),
+		MaxAttempts: 2,
+		RunAt:       time.Now().Add(-time.Minute),
+	}
+	err := jobs.Insert(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM jobs WHERE id = $1", job.ID) })
+
+	expireLease := func() {
+		t.Helper()
+
+		_, err := db.Exec("UPDATE jobs SET locked_until = NOW() - interval '1 second' WHERE id = $1", job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := jobs.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expireLease()
+
+	// an abandoned job with attempts left is taken over
+	second, err := jobs.Claim(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, second.ID, job.ID)
+	assert.Equal(t, second.Attempts, 2)
+
+	// and the worker that lost it can no longer finish it
+	err = jobs.Complete(first)
+	assert.Equal(t, errors.Is(err, ErrLeaseExpired), true)
+	err = jobs.Fail(first, errors.New("too late"), nil)
+	assert.Equal(t, errors.Is(err, ErrLeaseExpired), true)
+
+	// once the last attempt is abandoned as well the job is dead rather than claimed again
+	expireLease()
+	_, err = jobs.Claim(time.Minute)
+	assert.Equal(t, errors.Is(err, ErrRecordNotFound), true)
+
+	var status string
+	err = db.QueryRow("SELECT status FROM jobs WHERE id = $1", job.ID).Scan(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, status, JobDead)
+}
@@ -2,17 +2,19 @@ package data
 
 import (
 	"context"
-	"database/sql"
+	"fmt"
 	"strconv"
 	"time"
 )
 
+// LikeType is the kind of reaction a user has left on a quote. Likes and dislikes feed into the
+// like counts and quote rankings, the other reactions are only recorded.
 type LikeType int8
 
 type Like struct {
 	UserID  int64    `json:"user_id"`
 	QuoteID int64    `json:"quote_id"`
-	Val     LikeType `json:"like_type"`
+	Val     LikeType `json:"reaction"`
 }
 
 type LikeCount struct {
@@ -23,62 +25,154 @@ type LikeCount struct {
 const (
 	DislikeValue = iota
 	LikeValue
+	LoveValue
+	InsightfulValue
+	FunnyValue
 )
 
+// likeTypeNames must match the rows of the reaction_types table. To add a reaction add a value
+// above, its name here and a migration inserting it into reaction_types.
+var likeTypeNames = map[LikeType]string{
+	DislikeValue:    "dislike",
+	LikeValue:       "like",
+	LoveValue:       "love",
+	InsightfulValue: "insightful",
+	FunnyValue:      "funny",
+}
+
+// ParseLikeType returns the reaction with the given name and whether the name is valid
+func ParseLikeType(name string) (LikeType, bool) {
+	for likeType, likeTypeName := range likeTypeNames {
+		if likeTypeName == name {
+			return likeType, true
+		}
+	}
+	return 0, false
+}
+
+// LikeTypeNames returns the names of every reaction in value order
+func LikeTypeNames() []string {
+	names := make([]string, 0, len(likeTypeNames))
+	for likeType := LikeType(0); int(likeType) < len(likeTypeNames); likeType++ {
+		names = append(names, likeTypeNames[likeType])
+	}
+	return names
+}
+
+func (l LikeType) String() string {
+	name, ok := likeTypeNames[l]
+	if !ok {
+		return fmt.Sprintf("LikeType(%d)", int8(l))
+	}
+	return name
+}
+
 func (l LikeType) MarshalJSON() ([]byte, error) {
-	switch l {
-	case LikeValue:
-		return []byte(strconv.Quote("like")), nil
-	case DislikeValue:
-		return []byte(strconv.Quote("dislike")), nil
-	default:
-		panic("invalid like type during JSON marshal")
+	name, ok := likeTypeNames[l]
+	if !ok {
+		return nil, fmt.Errorf("invalid like type %d during JSON marshal", int8(l))
 	}
+	return []byte(strconv.Quote(name)), nil
+}
+
+func (l *LikeType) UnmarshalJSON(js []byte) error {
+	name, err := strconv.Unquote(string(js))
+	if err != nil {
+		return fmt.Errorf("like type must be a JSON string: %w", err)
+	}
+
+	likeType, ok := ParseLikeType(name)
+	if !ok {
+		return fmt.Errorf("invalid like type %q", name)
+	}
+
+	*l = likeType
+	return nil
 }
 
 type LikesDatabaseModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func (m LikesDatabaseModel) LikeOrDislikeQuote(like Like) error {
+// SetReaction sets the user's reaction to the quote, replacing any reaction they had left before,
+// and reports whether that changed anything. Setting the reaction they already have changes
+// nothing so the call is safe to retry.
+func (m LikesDatabaseModel) SetReaction(like Like) (bool, error) {
 	query := `
-	MERGE INTO likes l
-	USING (
-		SELECT CAST($1 AS bigint) AS user_id, CAST($2 AS bigint) AS quote_id, CAST($3 AS smallint) AS val
-	) AS n
-	ON l.user_id = n.user_id AND l.quote_id = n.quote_id
-	WHEN NOT MATCHED THEN
-		INSERT VALUES(n.user_id, n.quote_id, n.val)
-	WHEN MATCHED AND l.val != n.val THEN
-		UPDATE SET val = n.val
-	WHEN MATCHED THEN
-		DELETE;
-	`
+		INSERT INTO likes (user_id, quote_id, val)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, quote_id) DO UPDATE
+		SET val = EXCLUDED.val, created_at = NOW()
+		WHERE likes.val != EXCLUDED.val`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	args := []interface{}{like.UserID, like.QuoteID, like.Val}
 
-	// TODO: upgrade to postgres 17 to support merge returning statements
-	// then return the merge_action()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, translateError(err)
+	}
+
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return numRows > 0, nil
 }
 
-func (m LikesDatabaseModel) GetLikeDislikeNumForQuote(quoteID int64) (*LikeCount, error) {
+// ClearReaction removes the user's reaction to the quote. It isn't an error if there was none.
+func (m LikesDatabaseModel) ClearReaction(userID, quoteID int64) error {
 	query := `
-	SELECT COUNT (CASE WHEN val = 0 THEN 1 ELSE NULL END) AS dislikes,
-		   COUNT (CASE WHEN val = 1 THEN 1 ELSE NULL END) AS likes
-	FROM likes`
+		DELETE FROM likes
+		WHERE user_id = $1 AND quote_id = $2`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var likeCount LikeCount
-	err := m.DB.QueryRowContext(ctx, query).Scan(&likeCount.DislikeNum, &likeCount.LikeNum)
-	if err != nil {
-		return nil, err
-	}
-	return &likeCount, nil
+	_, err := m.DB.ExecContext(ctx, query, userID, quoteID)
+	return err
+}
+
+// ReconcileCounts recomputes every quote's like_count and dislike_count from the likes table and
+// returns how many quotes had drifted. The likes table is locked against writes while it runs so
+// reactions made in the meantime can't be overwritten by stale counts.
+func (m LikesDatabaseModel) ReconcileCounts() (int64, error) {
+	query := `
+		UPDATE quotes
+		SET like_count = counts.likes, dislike_count = counts.dislikes
+		FROM (
+			SELECT quotes.id,
+				COUNT(likes.val) FILTER (WHERE likes.val = 1) AS likes,
+				COUNT(likes.val) FILTER (WHERE likes.val = 0) AS dislikes
+			FROM quotes
+			LEFT JOIN likes ON likes.quote_id = quotes.id
+			GROUP BY quotes.id
+		) AS counts
+		WHERE quotes.id = counts.id
+		AND (quotes.like_count != counts.likes OR quotes.dislike_count != counts.dislikes)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var reconciled int64
+
+	err := withTx(ctx, m.DB, func(tx DBTX) error {
+		_, err := tx.ExecContext(ctx, "LOCK TABLE likes IN SHARE MODE")
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		reconciled, err = result.RowsAffected()
+		return err
+	})
+
+	return reconciled, err
 }
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+func TestLikeTypeJSON(t *testing.T) {
+	for likeType, name := range likeTypeNames {
+		t.Run(name, func(t *testing.T) {
+			js, err := json.Marshal(likeType)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, string(js), `"`+name+`"`)
+
+			var decoded LikeType
+			err = json.Unmarshal(js, &decoded)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, decoded, likeType)
+		})
+	}
+
+	t.Run("unknown value", func(t *testing.T) {
+		_, err := json.Marshal(LikeType(100))
+		if err == nil {
+			t.Error("expected an error marshalling an unknown like type")
+		}
+	})
+
+	t.Run("unknown name", func(t *testing.T) {
+		var decoded LikeType
+		err := json.Unmarshal([]byte(`"meh"`), &decoded)
+		if err == nil {
+			t.Error("expected an error unmarshalling an unknown like type")
+		}
+	})
+
+	t.Run("number", func(t *testing.T) {
+		var decoded LikeType
+		err := json.Unmarshal([]byte(`1`), &decoded)
+		if err == nil {
+			t.Error("expected an error unmarshalling a number")
+		}
+	})
+}
+
+func TestReactionCountsConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	likes := LikesDatabaseModel{DB: db}
+	quotes := QuoteDatabaseModel{DB: db}
+
+	owner := insertTestUser(t, db)
+	quoteID := insertTestQuote(t, db, owner)
+
+	const reactors = 20
+	userIDs := make([]int64, reactors)
+	for i := range userIDs {
+		userIDs[i] = insertTestUser(t, db)
+	}
+
+	// every user likes, dislikes and then likes the quote again while the others do the same, with
+	// every other user clearing their reaction at the end
+	var wg sync.WaitGroup
+	errs := make(chan error, reactors)
+	for i, userID := range userIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, val := range []LikeType{LikeValue, DislikeValue, LikeValue} {
+				_, err := likes.SetReaction(Like{UserID: userID, QuoteID: quoteID, Val: val})
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			if i%2 == 0 {
+				err := likes.ClearReaction(userID, quoteID)
+				if err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	quote, err := quotes.Get(quoteID, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, quote.Likes, int64(reactors/2))
+	assert.Equal(t, quote.Dislikes, int64(0))
+
+	// drift the counter by hand and check that reconciling repairs it
+	_, err = db.Exec("UPDATE quotes SET like_count = 0 WHERE id = $1", quoteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reconciled, err := likes.ReconcileCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconciled < 1 {
+		t.Errorf("expected at least 1 reconciled quote; got %d", reconciled)
+	}
+
+	quote, err = quotes.Get(quoteID, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, quote.Likes, int64(reactors/2))
+}
@@ -11,19 +11,52 @@ var (
 )
 
 type Models struct {
-	Quotes      QuoteDatabaseModel // change to corresponding interfaces when ready.
-	Users       UserDatabaseModel
-	Tokens      TokenDatabaseModel
-	Permissions PermissionDatabaseModel
-	Like        LikesDatabaseModel
+	Quotes        QuoteDatabaseModel // change to corresponding interfaces when ready.
+	Users         UserDatabaseModel
+	Tokens        TokenDatabaseModel
+	Permissions   PermissionDatabaseModel
+	Like          LikesDatabaseModel
+	Collections   CollectionDatabaseModel
+	Comments      CommentDatabaseModel
+	Follows       FollowDatabaseModel
+	Notifications NotificationDatabaseModel
+	Webhooks      WebhookDatabaseModel
+	StreamEvents  StreamEventDatabaseModel
+	Jobs          JobDatabaseModel
+	Digests       DigestDatabaseModel
+	SavedSearches SavedSearchDatabaseModel
+	Reviews       ReviewDatabaseModel
+	Notes         NoteDatabaseModel
+
+	// used to start transactions, nil for models that are already part of one
+	db *sql.DB
 }
 
 func New(db *sql.DB) Models {
+	models := newModels(db)
+	models.db = db
+
+	return models
+}
+
+// newModels sets up the models to run their queries on db, which may be a transaction
+func newModels(db DBTX) Models {
 	return Models{
-		Quotes:      QuoteDatabaseModel{DB: db},
-		Users:       UserDatabaseModel{DB: db},
-		Tokens:      TokenDatabaseModel{DB: db},
-		Permissions: PermissionDatabaseModel{DB: db},
-		Like:        LikesDatabaseModel{DB: db},
+		Quotes:        QuoteDatabaseModel{DB: db},
+		Users:         UserDatabaseModel{DB: db},
+		Tokens:        TokenDatabaseModel{DB: db},
+		Permissions:   PermissionDatabaseModel{DB: db},
+		Like:          LikesDatabaseModel{DB: db},
+		Collections:   CollectionDatabaseModel{DB: db},
+		Comments:      CommentDatabaseModel{DB: db},
+		Follows:       FollowDatabaseModel{DB: db},
+		Notifications: NotificationDatabaseModel{DB: db},
+		Webhooks:      WebhookDatabaseModel{DB: db},
+		StreamEvents:  StreamEventDatabaseModel{DB: db},
+		Jobs:          JobDatabaseModel{DB: db},
+		Digests:       DigestDatabaseModel{DB: db},
+		SavedSearches: SavedSearchDatabaseModel{DB: db},
+		Reviews:       ReviewDatabaseModel{DB: db},
+		Notes:         NoteDatabaseModel{DB: db},
 	}
 }
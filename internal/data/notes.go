@@ -0,0 +1,176 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+// Note is a user's private note on a quote. Each user has at most one note per quote.
+type Note struct {
+	UserID       int64     `json:"-"`
+	QuoteID      int64     `json:"quote_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastModified time.Time `json:"last_modified"`
+	Body         string    `json:"body"`
+	// only set in search results
+	Quote *Quote `json:"quote,omitempty"`
+}
+
+type NoteDatabaseModel struct {
+	DB DBTX
+}
+
+func NormaliseNote(note *Note) {
+	note.Body = normaliseText(note.Body)
+}
+
+// the length limit is in characters to match notes_body_check
+func ValidateNote(v *validator.Validator, note *Note) {
+	v.Check(note.Body != "", "body", "must be provided")
+	v.Check(utf8.RuneCountInString(note.Body) <= 5000, "body", "must not be more than 5000 characters")
+	v.Check(validator.NoControlChars(note.Body, '\n'), "body", "must not contain control characters")
+}
+
+const noteColumns = `notes.user_id, notes.quote_id, notes.created_at, notes.last_modified, notes.body`
+
+func (n *Note) scanDest() []interface{} {
+	return []interface{}{
+		&n.UserID,
+		&n.QuoteID,
+		&n.CreatedAt,
+		&n.LastModified,
+		&n.Body,
+	}
+}
+
+// Set creates the user's note on the quote or replaces its body if there already is one. It
+// returns true if the note was created.
+func (m *NoteDatabaseModel) Set(note *Note) (bool, error) {
+	// xmax is only zero for rows that were inserted rather than updated
+	query := `
+		INSERT INTO notes (user_id, quote_id, body)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, quote_id) DO UPDATE
+		SET body = EXCLUDED.body
+		RETURNING created_at, last_modified, xmax = 0`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var created bool
+
+	err := m.DB.QueryRowContext(ctx, query, note.UserID, note.QuoteID, note.Body).Scan(
+		&note.CreatedAt,
+		&note.LastModified,
+		&created,
+	)
+	return created, translateError(err)
+}
+
+func (m *NoteDatabaseModel) Get(userID, quoteID int64) (*Note, error) {
+	query := `
+		SELECT ` + noteColumns + `
+		FROM notes
+		WHERE user_id = $1 AND quote_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var note Note
+
+	err := m.DB.QueryRowContext(ctx, query, userID, quoteID).Scan(note.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &note, nil
+}
+
+func (m *NoteDatabaseModel) Delete(userID, quoteID int64) error {
+	query := `
+		DELETE FROM notes WHERE user_id = $1 AND quote_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, quoteID)
+	if err != nil {
+		return err
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// noteOrderBy returns the ORDER BY expression for the filters. sort=relevance ranks the notes by
+// how well they match the search text bound to $2.
+func noteOrderBy(filters Filters) string {
+	column := filters.sortColumn()
+	if column == "relevance" {
+		return "ts_rank(to_tsvector('english', notes.body), plainto_tsquery('english', $2)) DESC, notes.last_modified DESC"
+	}
+	return fmt.Sprintf("notes.%s %s, notes.quote_id ASC", column, filters.sortDirection())
+}
+
+// Search lists the user's notes whose body matches the search text, or all of their notes if it is
+// empty, along with their quotes. Notes on quotes the user can no longer see are left out.
+func (m *NoteDatabaseModel) Search(userID int64, text string, filters Filters) ([]*Note, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s, %s
+		FROM notes
+		INNER JOIN quotes ON quotes.id = notes.quote_id
+		WHERE notes.user_id = $1
+		AND (to_tsvector('english', notes.body) @@ plainto_tsquery('english', $2) OR $2 = '')
+		AND %s
+		ORDER BY %s
+		LIMIT $3 OFFSET $4`, noteColumns, quoteColumns, viewableBy("$1"), noteOrderBy(filters))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, text, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	notes := []*Note{}
+
+	var totalRecords int
+
+	for rows.Next() {
+		note := Note{Quote: &Quote{}}
+		dest := append([]interface{}{&totalRecords}, note.scanDest()...)
+		err := rows.Scan(append(dest, note.Quote.scanDest()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		notes = append(notes, &note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return notes, metadata, nil
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+func TestValidateNote(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{name: "empty", body: "", valid: false},
+		{name: "multi-line", body: "Read at the wedding.\nEveryone cried.", valid: true},
+		{name: "control character", body: "ring the bell\a", valid: false},
+		{name: "5000 multi-byte characters", body: strings.Repeat("é", 5000), valid: true},
+		{name: "5001 characters", body: strings.Repeat("a", 5001), valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateNote(v, &Note{Body: test.body})
+			assert.Equal(t, v.Valid(), test.valid)
+		})
+	}
+}
+
+func TestNoteSetAndSearch(t *testing.T) {
+	db := newTestDB(t)
+	notes := NoteDatabaseModel{DB: db}
+
+	userID := insertTestUser(t, db)
+	otherID := insertTestUser(t, db)
+	quoteID := insertTestQuote(t, db, otherID)
+
+	note := &Note{UserID: userID, QuoteID: quoteID, Body: "Quoted this in my wedding speech"}
+	created, err := notes.Set(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, created, true)
+
+	// setting it again replaces the body of the same note
+	note.Body = "Quoted this in my brother's wedding speech"
+	created, err = notes.Set(note)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, created, false)
+
+	filters := Filters{Page: 1, PageSize: 20, Sort: "relevance", SortSafeList: []string{"relevance"}}
+
+	found, _, err := notes.Search(userID, "weddings", filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(found), 1)
+	assert.Equal(t, found[0].Body, note.Body)
+	assert.Equal(t, found[0].Quote.ID, quoteID)
+
+	// notes are private to the user who wrote them
+	found, _, err = notes.Search(otherID, "wedding", filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(found), 0)
+}
@@ -0,0 +1,224 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The events users are notified about. They must match notifications_type_check.
+const (
+	NotificationReaction    = "reaction"     // someone reacted to one of your quotes
+	NotificationComment     = "comment"      // someone commented on one of your quotes
+	NotificationReply       = "reply"        // someone replied to one of your comments
+	NotificationFollow      = "follow"       // someone followed you
+	NotificationSavedSearch = "saved_search" // a new quote matches one of your saved searches
+)
+
+var NotificationTypes = []string{NotificationReaction, NotificationComment, NotificationReply, NotificationFollow, NotificationSavedSearch}
+
+type Notification struct {
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UserID        int64      `json:"-"`
+	ActorID       int64      `json:"actor_id"`
+	ActorUsername string     `json:"actor_username"`
+	Type          string     `json:"type"`
+	QuoteID       *int64     `json:"quote_id,omitempty"`
+	CommentID     *int64     `json:"comment_id,omitempty"`
+	ReadAt        *time.Time `json:"read_at"`
+}
+
+type NotificationDatabaseModel struct {
+	DB DBTX
+}
+
+// Insert stores the notification unless it would be pointless: users aren't notified about their
+// own actions or about types they have turned off, and repeated reactions or follows by the same
+// user aren't notified again while the first notification is still unread.
+func (m *NotificationDatabaseModel) Insert(notification *Notification) error {
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, quote_id, comment_id)
+		SELECT $1::bigint, $2::bigint, $3::text, $4::bigint, $5::bigint
+		WHERE $1 != $2
+		AND NOT EXISTS (
+			SELECT 1 FROM notification_preferences
+			WHERE user_id = $1 AND type = $3 AND NOT enabled
+		)
+		AND NOT (
+			$3 IN ('reaction', 'follow') AND EXISTS (
+				SELECT 1 FROM notifications
+				WHERE user_id = $1 AND actor_id = $2 AND type = $3
+				AND quote_id IS NOT DISTINCT FROM $4 AND read_at IS NULL
+			)
+		)`
+
+	args := []interface{}{
+		notification.UserID,
+		notification.ActorID,
+		notification.Type,
+		notification.QuoteID,
+		notification.CommentID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return translateError(err)
+}
+
+// GetAllForUser lists the user's notifications newest first, optionally only the unread ones
+func (m *NotificationDatabaseModel) GetAllForUser(userID int64, unreadOnly bool, filters Filters) ([]*Notification, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), notifications.id, notifications.created_at, notifications.user_id,
+			notifications.actor_id, users.username, notifications.type, notifications.quote_id,
+			notifications.comment_id, notifications.read_at
+		FROM notifications
+		INNER JOIN users ON users.id = notifications.actor_id
+		WHERE notifications.user_id = $1
+		AND (NOT $2 OR notifications.read_at IS NULL)
+		ORDER BY notifications.created_at %s, notifications.id %s
+		LIMIT $3 OFFSET $4`, filters.sortDirection(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, unreadOnly, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	notifications := []*Notification{}
+
+	var totalRecords int
+
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(
+			&totalRecords,
+			&notification.ID,
+			&notification.CreatedAt,
+			&notification.UserID,
+			&notification.ActorID,
+			&notification.ActorUsername,
+			&notification.Type,
+			&notification.QuoteID,
+			&notification.CommentID,
+			&notification.ReadAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		notifications = append(notifications, &notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return notifications, metadata, nil
+}
+
+func (m *NotificationDatabaseModel) UnreadCount(userID int64) (int, error) {
+	query := `
+		SELECT count(*) FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks the user's notifications with the given IDs as read, or all of them if no IDs
+// are given. IDs of other users' notifications are ignored. It returns how many were marked.
+func (m *NotificationDatabaseModel) MarkRead(userID int64, ids []int64) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL
+		AND (cardinality($2::bigint[]) = 0 OR id = ANY($2))`
+
+	if ids == nil {
+		ids = []int64{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// GetPreferences returns whether each notification type is enabled for the user
+func (m *NotificationDatabaseModel) GetPreferences(userID int64) (map[string]bool, error) {
+	query := `
+		SELECT type, enabled FROM notification_preferences
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	preferences := make(map[string]bool, len(NotificationTypes))
+	for _, notificationType := range NotificationTypes {
+		preferences[notificationType] = true
+	}
+
+	for rows.Next() {
+		var notificationType string
+		var enabled bool
+		err := rows.Scan(&notificationType, &enabled)
+		if err != nil {
+			return nil, err
+		}
+
+		preferences[notificationType] = enabled
+	}
+
+	return preferences, rows.Err()
+}
+
+// SetPreferences turns the given notification types on or off for the user, types left out of the
+// map keep their current setting
+func (m *NotificationDatabaseModel) SetPreferences(userID int64, preferences map[string]bool) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, type, enabled)
+		SELECT $1, preference.type, preference.enabled
+		FROM unnest($2::text[], $3::bool[]) AS preference (type, enabled)
+		ON CONFLICT (user_id, type) DO UPDATE
+		SET enabled = EXCLUDED.enabled`
+
+	types := make([]string, 0, len(preferences))
+	enabled := make([]bool, 0, len(preferences))
+	for notificationType, on := range preferences {
+		types = append(types, notificationType)
+		enabled = append(enabled, on)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(types), pq.Array(enabled))
+	return translateError(err)
+}
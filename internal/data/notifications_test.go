@@ -0,0 +1,85 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+func TestNotificationInsert(t *testing.T) {
+	db := newTestDB(t)
+	notifications := NotificationDatabaseModel{DB: db}
+
+	ownerID := insertTestUser(t, db)
+	actorID := insertTestUser(t, db)
+	quoteID := insertTestQuote(t, db, ownerID)
+
+	unread := func() int {
+		count, err := notifications.UnreadCount(ownerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	insert := func(notification Notification) {
+		err := notifications.Insert(&notification)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reaction := Notification{UserID: ownerID, ActorID: actorID, Type: NotificationReaction, QuoteID: &quoteID}
+
+	// users aren't notified about their own actions
+	insert(Notification{UserID: ownerID, ActorID: ownerID, Type: NotificationReaction, QuoteID: &quoteID})
+	assert.Equal(t, unread(), 0)
+
+	// a repeated reaction collapses into the unread notification about the first
+	insert(reaction)
+	insert(reaction)
+	assert.Equal(t, unread(), 1)
+
+	// comments are never collapsed
+	insert(Notification{UserID: ownerID, ActorID: actorID, Type: NotificationComment, QuoteID: &quoteID})
+	insert(Notification{UserID: ownerID, ActorID: actorID, Type: NotificationComment, QuoteID: &quoteID})
+	assert.Equal(t, unread(), 3)
+
+	err := notifications.SetPreferences(ownerID, map[string]bool{NotificationFollow: false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert(Notification{UserID: ownerID, ActorID: actorID, Type: NotificationFollow})
+	assert.Equal(t, unread(), 3)
+
+	listed, _, err := notifications.GetAllForUser(ownerID, true, Filters{Page: 1, PageSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(listed), 3)
+
+	// other users can't mark the owner's notifications as read
+	marked, err := notifications.MarkRead(actorID, []int64{listed[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, marked, int64(0))
+
+	marked, err = notifications.MarkRead(ownerID, []int64{listed[0].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, marked, int64(1))
+	assert.Equal(t, unread(), 2)
+
+	marked, err = notifications.MarkRead(ownerID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, marked, int64(2))
+	assert.Equal(t, unread(), 0)
+
+	// once the earlier notification has been read a new reaction is notified again
+	insert(reaction)
+	assert.Equal(t, unread(), 1)
+}
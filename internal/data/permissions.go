@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/lib/pq"
@@ -20,7 +19,7 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionDatabaseModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (m *PermissionDatabaseModel) GetAllForUser(id int64) (Permissions, error) {
@@ -68,5 +67,5 @@ func (m *PermissionDatabaseModel) AddForUser(userID int64, codes ...string) erro
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
+	return translateError(err)
 }
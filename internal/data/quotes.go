@@ -2,39 +2,135 @@ package data
 
 import (
 	"context"
+	"crypto/md5"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/WanderingAura/quotable/internal/validator"
 	"github.com/lib/pq"
+	"golang.org/x/text/unicode/norm"
 )
 
 type Quote struct {
-	ID           int64     `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	LastModified time.Time `json:"last_modified"`
-	UserID       int64     `json:"user_id"`
-	Content      string    `json:"content"`
-	Author       string    `json:"author"`
-	Source       Source    `json:"source,omitempty"`
-	Tags         []string  `json:"tags"`
-	Version      int       `json:"version"`
-}
-
-type QuoteOutput struct {
-	ID           int64     `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	LastModified time.Time `json:"last_modified"`
-	UserID       int64     `json:"user_id"`
-	Content      string    `json:"content"`
-	Author       string    `json:"author"`
-	Source       Source    `json:"source,omitempty"`
-	Tags         []string  `json:"tags"`
-	Likes        int       `json:"likes"`
-	Dislikes     int       `json:"dislikes"`
-	Version      int       `json:"version"`
+	ID           int64      `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastModified time.Time  `json:"last_modified"`
+	UserID       int64      `json:"user_id"`
+	Content      string     `json:"content"`
+	Author       string     `json:"author"`
+	Source       Source     `json:"source,omitempty"`
+	Tags         []string   `json:"tags"`
+	Visibility   string     `json:"visibility"`
+	Status       string     `json:"status"`
+	PublishAt    *time.Time `json:"publish_at,omitempty"`
+	Likes        int64      `json:"likes"`
+	Dislikes     int64      `json:"dislikes"`
+	CommentCount int64      `json:"comment_count"`
+	Version      int        `json:"version"`
+	// the viewer's own reaction, only set when they have reacted to the quote
+	MyReaction *LikeType `json:"my_reaction,omitempty"`
+	// the viewer's private note, only set when fetching a single quote they have annotated
+	MyNote *Note `json:"my_note,omitempty"`
+}
+
+// Public quotes are listed for everyone, unlisted quotes can only be fetched by ID and private
+// quotes are only ever shown to their owner
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
+// Drafts and scheduled quotes are only shown to their owner until they are published. A scheduled
+// quote counts as published as soon as its publish time has passed, even if the publish scheduler
+// hasn't updated its status yet.
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+)
+
+var Statuses = []string{StatusDraft, StatusScheduled, StatusPublished}
+
+// Listed reports whether the quote is public and published, so that it shows up in everyone's
+// listings and searches
+func (q *Quote) Listed() bool {
+	return q.Visibility == VisibilityPublic && q.Status == StatusPublished
+}
+
+const publishedCondition = `(quotes.status = 'published' OR (quotes.status = 'scheduled' AND quotes.publish_at <= NOW()))`
+
+// viewableBy returns a WHERE condition matching the quotes that the user whose ID is bound to the
+// placeholder can fetch by ID
+func viewableBy(placeholder string) string {
+	return fmt.Sprintf("(quotes.user_id = %s OR (quotes.visibility != 'private' AND %s))", placeholder, publishedCondition)
+}
+
+// listableBy returns a WHERE condition matching the quotes that the user whose ID is bound to the
+// placeholder can see in listings and searches
+func listableBy(placeholder string) string {
+	return fmt.Sprintf("(quotes.user_id = %s OR (quotes.visibility = 'public' AND %s))", placeholder, publishedCondition)
+}
+
+// the ranked sorts read their scores from the quote_scores materialized view
+var quoteScoreSorts = map[string]string{
+	"hot":       "quote_scores.hot",
+	"top_day":   "quote_scores.top_day",
+	"top_week":  "quote_scores.top_week",
+	"top_month": "quote_scores.top_month",
+	"top_all":   "quote_scores.top_all",
+}
+
+// quoteOrderBy returns the ORDER BY expression for the filters. Ranked sorts always put the highest
+// scoring quotes first. Quotes created since quote_scores was last refreshed have no score yet so
+// they go last.
+func quoteOrderBy(filters Filters) string {
+	column := filters.sortColumn()
+	if scoreColumn, ok := quoteScoreSorts[column]; ok {
+		return fmt.Sprintf("%s DESC NULLS LAST, quotes.id DESC", scoreColumn)
+	}
+	return fmt.Sprintf("quotes.%s %s, quotes.created_at ASC", column, filters.sortDirection())
+}
+
+// A group of quotes whose content is the same once normalised
+type DuplicateCluster struct {
+	Fingerprint string  `json:"fingerprint"`
+	QuoteIDs    []int64 `json:"quote_ids"`
+	Size        int     `json:"size"`
+}
+
+// QuoteSearch holds the criteria quotes are searched by. Empty fields match every quote.
+type QuoteSearch struct {
+	Content string   `json:"content"`
+	Author  string   `json:"author"`
+	Tags    []string `json:"tags"`
+}
+
+// where returns the WHERE condition for the search, with its arguments bound to consecutive
+// placeholders starting from $first
+func (s QuoteSearch) where(first int) (string, []interface{}) {
+	condition := fmt.Sprintf(`(to_tsvector('english', quotes.content) @@ plainto_tsquery('english', $%[1]d) OR $%[1]d = '')
+		AND (lower(quotes.author) = lower($%[2]d) OR $%[2]d = '')
+		AND (quotes.tags @> $%[3]d OR $%[3]d = '{}')`, first, first+1, first+2)
+
+	tags := s.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	return condition, []interface{}{s.Content, s.Author, pq.Array(tags)}
 }
 
 // TODO: make the source type marhsal JSON and unmarshal using the format sourceTitle(sourceType)?
@@ -43,6 +139,40 @@ type Source struct {
 	Type  string `json:"type"`
 }
 
+// the columns read into a Quote by scanDest, qualified so they can be selected alongside joins
+const quoteColumns = `quotes.id, quotes.created_at, quotes.last_modified, quotes.user_id, quotes.content,
+	quotes.author, quotes.source_title, quotes.source_type, quotes.tags, quotes.visibility, quotes.status,
+	quotes.publish_at, quotes.like_count, quotes.dislike_count, quotes.comment_count,
+	quotes.version`
+
+// myReactionJoin joins the reaction of the user whose ID is bound to the placeholder as my_like,
+// select my_like.val after quoteColumns to read it into Quote.MyReaction
+func myReactionJoin(placeholder string) string {
+	return fmt.Sprintf("LEFT JOIN likes AS my_like ON my_like.quote_id = quotes.id AND my_like.user_id = %s", placeholder)
+}
+
+// scanDest returns the scan destinations for quoteColumns
+func (q *Quote) scanDest() []interface{} {
+	return []interface{}{
+		&q.ID,
+		&q.CreatedAt,
+		&q.LastModified,
+		&q.UserID,
+		&q.Content,
+		&q.Author,
+		&q.Source.Title,
+		&q.Source.Type,
+		pq.Array(&q.Tags),
+		&q.Visibility,
+		&q.Status,
+		&q.PublishAt,
+		&q.Likes,
+		&q.Dislikes,
+		&q.CommentCount,
+		&q.Version,
+	}
+}
+
 type QuoteModel interface {
 	Insert(quote *Quote) error
 	Get(id int64) (*Quote, error)
@@ -51,49 +181,166 @@ type QuoteModel interface {
 }
 
 type QuoteDatabaseModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func (s *Source) isPartial() bool {
 	return (s.Title == "" || s.Type == "") && !(s.Title == "" && s.Type == "")
 }
 
+// normaliseContent reduces the content to lower case letters and digits separated by single spaces
+// so that quotes which only differ in punctuation, quote marks or whitespace compare as equal.
+// Changing it changes the fingerprints, so run RefreshFingerprints afterwards.
+func normaliseContent(content string) string {
+	var b strings.Builder
+	pendingSpace := false
+
+	for _, r := range strings.ToLower(content) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if pendingSpace && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			pendingSpace = false
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			pendingSpace = true
+		}
+	}
+
+	return b.String()
+}
+
+// ContentFingerprint returns the hex encoded md5 hash of the normalised content. Near-duplicate
+// quotes share a fingerprint. Content without any letters or digits has no fingerprint, so the
+// empty string is returned for it and it is never a duplicate of anything.
+func ContentFingerprint(content string) string {
+	normalised := normaliseContent(content)
+	if normalised == "" {
+		return ""
+	}
+
+	hash := md5.Sum([]byte(normalised))
+	return hex.EncodeToString(hash[:])
+}
+
+// normaliseText trims surrounding whitespace and converts s to unicode normalisation form C
+func normaliseText(s string) string {
+	return norm.NFC.String(strings.TrimSpace(s))
+}
+
+// NormaliseQuote normalises the user provided text of the quote so that visually identical input
+// is stored identically. It should be called before the quote is validated.
+func NormaliseQuote(quote *Quote) {
+	quote.Content = normaliseText(quote.Content)
+	quote.Author = normaliseText(quote.Author)
+	quote.Source.Title = normaliseText(quote.Source.Title)
+	quote.Source.Type = normaliseText(quote.Source.Type)
+
+	for i := range quote.Tags {
+		quote.Tags[i] = normaliseText(quote.Tags[i])
+	}
+}
+
+// the length limits are in characters to match the LENGTH() checks in migration 000004
 func ValidateQuote(v *validator.Validator, quote *Quote) {
+	v.Check(quote.Content != "", "content", "must be provided")
+	v.Check(utf8.RuneCountInString(quote.Content) < 300, "content", "must be less than 300 characters")
+	v.Check(validator.NoControlChars(quote.Content, '\n'), "content", "must not contain control characters")
+
 	v.Check(quote.Author != "", "author", "author must be provided")
-	v.Check(len(quote.Author) <= 100, "author", "author must be less than 100 bytes")
+	v.Check(utf8.RuneCountInString(quote.Author) < 100, "author", "author must be less than 100 characters")
+	v.Check(validator.NoControlChars(quote.Author), "author", "must not contain control characters")
 
 	v.Check(!quote.Source.isPartial(), "source", "either provide both source title and type or provide neither")
+	v.Check(utf8.RuneCountInString(quote.Source.Title) < 300, "source", "title must be less than 300 characters")
+	v.Check(utf8.RuneCountInString(quote.Source.Type) < 300, "source", "type must be less than 300 characters")
+	v.Check(validator.NoControlChars(quote.Source.Title+quote.Source.Type), "source", "must not contain control characters")
 
 	v.Check(quote.Tags != nil, "tags", "must be provided")
 	v.Check(len(quote.Tags) >= 1, "tags", "must contain at least one tag")
 	v.Check(len(quote.Tags) <= 10, "tags", "must not contain more than 10 tags")
 
+	for _, tag := range quote.Tags {
+		v.Check(tag != "", "tags", "must not contain empty values")
+		v.Check(validator.NoControlChars(tag), "tags", "must not contain control characters")
+	}
+
 	v.Check(validator.Unique(quote.Tags), "tags", "must not contain duplicate values")
+
+	v.Check(validator.In(quote.Visibility, Visibilities...), "visibility", "must be one of public, unlisted or private")
+
+	v.Check(validator.In(quote.Status, Statuses...), "status", "must be one of draft, scheduled or published")
+
+	switch quote.Status {
+	case StatusScheduled:
+		v.Check(quote.PublishAt != nil, "publish_at", "must be provided for scheduled quotes")
+	case StatusDraft:
+		v.Check(quote.PublishAt == nil, "publish_at", "must not be provided for drafts")
+	}
 }
 
-func (m *QuoteDatabaseModel) Get(id int64) (*Quote, error) {
-	query := `
-	SELECT id, created_at, last_modified, user_id, content, author, source_title, source_type, tags, version
+// ValidatePublishAt checks the publish time of a quote whose status or publish time is being set.
+// It isn't part of ValidateQuote because a scheduled quote stays valid after its publish time has
+// passed, while it waits for the scheduler, and can still be edited in the meantime.
+func ValidatePublishAt(v *validator.Validator, quote *Quote) {
+	if quote.PublishAt == nil {
+		return
+	}
+
+	v.Check(quote.Status == StatusScheduled, "publish_at", "must only be provided for scheduled quotes")
+	v.Check(quote.PublishAt.After(time.Now()), "publish_at", "must be in the future")
+}
+
+// Get returns the quote with the given ID if the viewer is allowed to see it. Use the ID of
+// data.AnonymousUser for unauthenticated viewers.
+func (m *QuoteDatabaseModel) Get(id int64, viewerID int64) (*Quote, error) {
+	query := fmt.Sprintf(`
+	SELECT %s, my_like.val
 	FROM quotes
-	WHERE id = $1`
+	%s
+	WHERE quotes.id = $1 AND %s`, quoteColumns, myReactionJoin("$2"), viewableBy("$2"))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var quote Quote
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&quote.ID,
-		&quote.CreatedAt,
-		&quote.LastModified,
-		&quote.UserID,
-		&quote.Content,
-		&quote.Author,
-		&quote.Source.Title,
-		&quote.Source.Type,
-		pq.Array(&quote.Tags),
-		&quote.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id, viewerID).Scan(append(quote.scanDest(), &quote.MyReaction)...)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &quote, nil
+}
+
+// FindDuplicate returns the oldest quote listable by the viewer whose content has the same
+// fingerprint as the given content, other than the quote with excludeID. Pass 0 to exclude none.
+func (m *QuoteDatabaseModel) FindDuplicate(content string, viewerID, excludeID int64) (*Quote, error) {
+	fingerprint := ContentFingerprint(content)
+	if fingerprint == "" {
+		return nil, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+	SELECT %s
+	FROM quotes
+	WHERE content_fingerprint = $1 AND quotes.id != $3 AND %s
+	ORDER BY id ASC
+	LIMIT 1`, quoteColumns, listableBy("$2"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var quote Quote
+
+	err := m.DB.QueryRowContext(ctx, query, fingerprint, viewerID, excludeID).Scan(quote.scanDest()...)
 
 	if err != nil {
 		switch {
@@ -110,30 +357,56 @@ func (m *QuoteDatabaseModel) Get(id int64) (*Quote, error) {
 func (m *QuoteDatabaseModel) Insert(quote *Quote) error {
 
 	query := `
-		INSERT INTO quotes (user_id, content, author, source_title, source_type, tags)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, version`
+		INSERT INTO quotes (user_id, content, author, source_title, source_type, tags, visibility, status, publish_at, content_fingerprint)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, last_modified, version`
 
-	args := []interface{}{quote.UserID, quote.Content, quote.Author, quote.Source.Title, quote.Source.Type, pq.Array(quote.Tags)}
+	args := []interface{}{
+		quote.UserID,
+		quote.Content,
+		quote.Author,
+		quote.Source.Title,
+		quote.Source.Type,
+		pq.Array(quote.Tags),
+		quote.Visibility,
+		quote.Status,
+		quote.PublishAt,
+		ContentFingerprint(quote.Content),
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
 		&quote.ID,
+		&quote.CreatedAt,
 		&quote.LastModified,
 		&quote.Version,
 	)
+	return translateError(err)
 }
 
 func (m *QuoteDatabaseModel) Update(quote *Quote) error {
 	query := `
 		UPDATE quotes
-		SET content=$1, author=$2, source_title=$3, source_type=$4, tags=$5, version=version+1
-		WHERE id = $5 AND version = $6
+		SET content=$1, author=$2, source_title=$3, source_type=$4, tags=$5, visibility=$6, status=$7, publish_at=$8,
+		content_fingerprint=$9, version=version+1
+		WHERE id = $10 AND version = $11
 		RETURNING version`
 
-	args := []interface{}{quote.Content, quote.Author, quote.Source.Title, quote.Source.Type, quote.Tags, quote.ID, quote.Version}
+	args := []interface{}{
+		quote.Content,
+		quote.Author,
+		quote.Source.Title,
+		quote.Source.Type,
+		pq.Array(quote.Tags),
+		quote.Visibility,
+		quote.Status,
+		quote.PublishAt,
+		ContentFingerprint(quote.Content),
+		quote.ID,
+		quote.Version,
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -144,29 +417,136 @@ func (m *QuoteDatabaseModel) Update(quote *Quote) error {
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return translateError(err)
 		}
 	}
 	return nil
 }
 
-func (m *QuoteDatabaseModel) GetAll(content string, tags []string, filters Filters) ([]*Quote, Metadata, error) {
+func (m *QuoteDatabaseModel) GetAll(viewerID int64, search QuoteSearch, filters Filters) ([]*Quote, Metadata, error) {
+	searchCondition, args := search.where(2)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s, my_like.val
+		FROM quotes
+		LEFT JOIN quote_scores ON quote_scores.quote_id = quotes.id
+		%s
+		WHERE %s
+		AND %s
+		ORDER BY %s
+		LIMIT $5 OFFSET $6`, quoteColumns, myReactionJoin("$1"), listableBy("$1"), searchCondition, quoteOrderBy(filters))
+
+	args = append([]interface{}{viewerID}, args...)
+	args = append(args, filters.limit(), filters.offset())
+
+	return m.list(query, args, filters)
+}
+
+// GetAllForUser lists the quotes created by userID. The owner sees all of their quotes while
+// everyone else only sees the public ones.
+func (m *QuoteDatabaseModel) GetAllForUser(userID int64, viewerID int64, search QuoteSearch, filters Filters) ([]*Quote, Metadata, error) {
+	searchCondition, args := search.where(3)
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s, my_like.val
+		FROM quotes
+		LEFT JOIN quote_scores ON quote_scores.quote_id = quotes.id
+		%s
+		WHERE quotes.user_id = $1
+		AND %s
+		AND %s
+		ORDER BY %s
+		LIMIT $6 OFFSET $7`, quoteColumns, myReactionJoin("$2"), listableBy("$2"), searchCondition, quoteOrderBy(filters))
+
+	args = append([]interface{}{userID, viewerID}, args...)
+	args = append(args, filters.limit(), filters.offset())
+
+	return m.list(query, args, filters)
+}
+
+// GetAllLikedBy lists the quotes that the user has liked and can still see, ordered by when they
+// were liked
+func (m *QuoteDatabaseModel) GetAllLikedBy(userID int64, filters Filters) ([]*Quote, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s, my_like.val
+		FROM quotes
+		%s
+		WHERE my_like.val = %d
+		AND %s
+		ORDER BY my_like.created_at %s, quotes.id %s
+		LIMIT $2 OFFSET $3`, quoteColumns, myReactionJoin("$1"), LikeValue, listableBy("$1"), filters.sortDirection(), filters.sortDirection())
+
+	args := []interface{}{userID, filters.limit(), filters.offset()}
+
+	return m.list(query, args, filters)
+}
+
+// GetAllInCollection lists the quotes in the collection that the viewer can see, ordered by their
+// position in the collection or by when they were added
+func (m *QuoteDatabaseModel) GetAllInCollection(collectionID int64, viewerID int64, filters Filters) ([]*Quote, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s, my_like.val
+		FROM collection_quotes
+		INNER JOIN quotes ON quotes.id = collection_quotes.quote_id
+		%s
+		WHERE collection_quotes.collection_id = $1
+		AND %s
+		ORDER BY collection_quotes.%s %s, quotes.id ASC
+		LIMIT $3 OFFSET $4`, quoteColumns, myReactionJoin("$2"), viewableBy("$2"), filters.sortColumn(), filters.sortDirection())
+
+	args := []interface{}{collectionID, viewerID, filters.limit(), filters.offset()}
+
+	return m.list(query, args, filters)
+}
 
-	// TODO: how would i get the likes and dislikes of a quote as well?
-	// if title or genre is empty then the WHERE conditions default to true
+// GetTopSince returns the public quotes that received the most positive reactions since the given
+// time, only counting quotes with at least one of the tags unless tags is empty
+func (m *QuoteDatabaseModel) GetTopSince(since time.Time, tags []string, limit int) ([]*Quote, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, last_modified, user_id, 
-		content, author, source_title, source_type, tags, version
+		SELECT %s
 		FROM quotes
-		WHERE (to_tsvector('english', quotes.content) @@ plainto_tsquery('english', $1) OR $1 = '')
-		AND (quotes.tags @> $2 OR $2 = '{}')
-		ORDER BY %s %s, created_at ASC
-		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+		INNER JOIN likes ON likes.quote_id = quotes.id
+		WHERE likes.created_at >= $1 AND likes.val != %d
+		AND (quotes.tags && $2 OR $2 = '{}')
+		AND %s
+		GROUP BY quotes.id
+		ORDER BY count(*) DESC, quotes.like_count DESC, quotes.id DESC
+		LIMIT $3`, quoteColumns, DislikeValue, listableBy("$4"))
+
+	if tags == nil {
+		tags = []string{}
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{content, pq.Array(tags), filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, since, pq.Array(tags), limit, AnonymousUser.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	quotes := []*Quote{}
+
+	for rows.Next() {
+		var quote Quote
+		err := rows.Scan(quote.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+
+		quotes = append(quotes, &quote)
+	}
+
+	return quotes, rows.Err()
+}
+
+// list runs a paginated query whose rows are the total record count, quoteColumns and then the
+// viewer's reaction from myReactionJoin
+func (m *QuoteDatabaseModel) list(query string, args []interface{}, filters Filters) ([]*Quote, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -181,23 +561,11 @@ func (m *QuoteDatabaseModel) GetAll(content string, tags []string, filters Filte
 
 	for rows.Next() {
 		var quote Quote
-		err := rows.Scan(
-			&totalRecords,
-			&quote.ID,
-			&quote.CreatedAt,
-			&quote.LastModified,
-			&quote.UserID,
-			&quote.Content,
-			&quote.Author,
-			&quote.Source.Title,
-			&quote.Source.Type,
-			pq.Array(&quote.Tags),
-			&quote.Version,
-		)
+		dest := append([]interface{}{&totalRecords}, quote.scanDest()...)
+		err := rows.Scan(append(dest, &quote.MyReaction)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		// TODO: add likes and dislikes query here.
 
 		quotes = append(quotes, &quote)
 	}
@@ -211,55 +579,181 @@ func (m *QuoteDatabaseModel) GetAll(content string, tags []string, filters Filte
 	return quotes, metadata, nil
 }
 
-func (m *QuoteDatabaseModel) GetAllForUser(userID int64, content string, tags []string, filters Filters) ([]*Quote, Metadata, error) {
+// GetRandom returns a random quote listable by the viewer that matches the search. Rather than
+// sorting every matching row it picks a random point in the ID range and returns the first match
+// from there, so it stays cheap on large tables at the cost of a bias towards quotes after gaps.
+func (m *QuoteDatabaseModel) GetRandom(viewerID int64, search QuoteSearch) (*Quote, error) {
+	minID, maxID, err := m.idRange()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.firstMatchFrom(minID+rand.Int64N(maxID-minID+1), viewerID, search)
+}
+
+// GetDaily returns the quote of the day for the date in the given time zone. The first instance
+// to ask for a day chooses its quote deterministically and stores it in daily_quotes, every later
+// request reads that choice back so all instances agree.
+func (m *QuoteDatabaseModel) GetDaily(date time.Time, timezone string) (*Quote, error) {
+	day := date.Format(time.DateOnly)
+
+	quote, err := m.getStoredDaily(day, timezone)
+	if !errors.Is(err, ErrRecordNotFound) {
+		return quote, err
+	}
+
+	minID, maxID, err := m.idRange()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(day + "/" + timezone))
+	pivot := minID + int64(hash.Sum64()%uint64(maxID-minID+1))
+
+	quote, err = m.firstMatchFrom(pivot, AnonymousUser.ID, QuoteSearch{})
+	if err != nil {
+		return nil, err
+	}
 
-	// if title or genre is empty then the WHERE conditions default to true
+	// only replace an existing choice if its quote has since stopped being public
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, created_at, last_modified, user_id, 
-		content, author, source_title, source_type, tags, version
-		FROM quotes
-		WHERE user_id = $1
-		AND(to_tsvector('english', quotes.content) @@ plainto_tsquery('english', $2) OR $2 = '')
-		AND (quotes.tags @> $3 OR $3 = '{}')
-		ORDER BY %s %s, created_at ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+		INSERT INTO daily_quotes (day, timezone, quote_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (day, timezone) DO UPDATE SET quote_id = EXCLUDED.quote_id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM quotes WHERE quotes.id = daily_quotes.quote_id AND %s
+		)`, listableBy("$4"))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{userID, content, pq.Array(tags), filters.limit(), filters.offset()}
+	_, err = m.DB.ExecContext(ctx, query, day, timezone, quote.ID, AnonymousUser.ID)
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	return m.getStoredDaily(day, timezone)
+}
+
+func (m *QuoteDatabaseModel) getStoredDaily(day, timezone string) (*Quote, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM daily_quotes
+		INNER JOIN quotes ON quotes.id = daily_quotes.quote_id
+		WHERE daily_quotes.day = $1 AND daily_quotes.timezone = $2 AND %s`, quoteColumns, listableBy("$3"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var quote Quote
+
+	err := m.DB.QueryRowContext(ctx, query, day, timezone, AnonymousUser.ID).Scan(quote.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &quote, nil
+}
+
+// returns the lowest and highest quote IDs, using the primary key index rather than a table scan
+func (m *QuoteDatabaseModel) idRange() (int64, int64, error) {
+	query := `SELECT min(id), max(id) FROM quotes`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var minID, maxID sql.NullInt64
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&minID, &maxID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !minID.Valid {
+		return 0, 0, ErrRecordNotFound
+	}
+
+	return minID.Int64, maxID.Int64, nil
+}
+
+// firstMatchFrom returns the matching quote with the lowest ID that is at least pivot, wrapping
+// round to the lowest matching ID overall if there isn't one
+func (m *QuoteDatabaseModel) firstMatchFrom(pivot int64, viewerID int64, search QuoteSearch) (*Quote, error) {
+	searchCondition, searchArgs := search.where(3)
+
+	for _, idCondition := range []string{"quotes.id >= $1", "quotes.id < $1"} {
+		query := fmt.Sprintf(`
+			SELECT %s
+			FROM quotes
+			WHERE %s AND %s AND %s
+			ORDER BY quotes.id ASC
+			LIMIT 1`, quoteColumns, idCondition, listableBy("$2"), searchCondition)
+
+		args := append([]interface{}{pivot, viewerID}, searchArgs...)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+
+		var quote Quote
+		err := m.DB.QueryRowContext(ctx, query, args...).Scan(quote.scanDest()...)
+		cancel()
+
+		switch {
+		case err == nil:
+			return &quote, nil
+		case !errors.Is(err, sql.ErrNoRows):
+			return nil, err
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// GetDuplicateClusters returns every group of two or more quotes that share a content fingerprint
+func (m *QuoteDatabaseModel) GetDuplicateClusters(filters Filters) ([]*DuplicateCluster, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), content_fingerprint, array_agg(id ORDER BY id), count(*) AS size, min(id) AS first_id
+		FROM quotes
+		WHERE content_fingerprint != ''
+		GROUP BY content_fingerprint
+		HAVING count(*) > 1
+		ORDER BY %s %s, first_id ASC
+		LIMIT $1 OFFSET $2`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
 
 	defer rows.Close()
 
-	quotes := []*Quote{}
+	clusters := []*DuplicateCluster{}
 
 	var totalRecords int
+	var firstID int64
 
 	for rows.Next() {
-		var quote Quote
+		var cluster DuplicateCluster
 		err := rows.Scan(
 			&totalRecords,
-			&quote.ID,
-			&quote.CreatedAt,
-			&quote.LastModified,
-			&quote.UserID,
-			&quote.Content,
-			&quote.Author,
-			&quote.Source.Title,
-			&quote.Source.Type,
-			pq.Array(&quote.Tags),
-			&quote.Version,
+			&cluster.Fingerprint,
+			pq.Array(&cluster.QuoteIDs),
+			&cluster.Size,
+			&firstID,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
 
-		quotes = append(quotes, &quote)
+		clusters = append(clusters, &cluster)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -268,7 +762,137 @@ func (m *QuoteDatabaseModel) GetAllForUser(userID int64, content string, tags []
 
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
-	return quotes, metadata, nil
+	return clusters, metadata, nil
+}
+
+// RefreshFingerprints recomputes the content fingerprint of every quote with ContentFingerprint and
+// returns how many had changed. The backfill in migration 000010 was computed in SQL, whose
+// character classes depend on the database's locale, so its fingerprints may not match the ones
+// computed for new quotes until this has been run.
+func (m *QuoteDatabaseModel) RefreshFingerprints() (int64, error) {
+	const batchSize = 1000
+
+	var refreshed int64
+	var lastID int64
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+		rows, err := m.DB.QueryContext(ctx, `
+			SELECT id, content, content_fingerprint
+			FROM quotes
+			WHERE id > $1
+			ORDER BY id ASC
+			LIMIT $2`, lastID, batchSize)
+		if err != nil {
+			cancel()
+			return refreshed, err
+		}
+
+		type staleQuote struct {
+			id          int64
+			content     string
+			fingerprint string
+		}
+		var stale []staleQuote
+		count := 0
+
+		for rows.Next() {
+			var quote staleQuote
+			var current string
+			err := rows.Scan(&quote.id, &quote.content, &current)
+			if err != nil {
+				rows.Close()
+				cancel()
+				return refreshed, err
+			}
+
+			count++
+			lastID = quote.id
+
+			quote.fingerprint = ContentFingerprint(quote.content)
+			if quote.fingerprint != current {
+				stale = append(stale, quote)
+			}
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			cancel()
+			return refreshed, err
+		}
+
+		for _, quote := range stale {
+			// the content check skips quotes that were edited in the meantime, their update has
+			// already stored the right fingerprint
+			res, err := m.DB.ExecContext(ctx, `
+				UPDATE quotes SET content_fingerprint = $2
+				WHERE id = $1 AND content = $3`, quote.id, quote.fingerprint, quote.content)
+			if err != nil {
+				cancel()
+				return refreshed, err
+			}
+
+			numRows, err := res.RowsAffected()
+			if err != nil {
+				cancel()
+				return refreshed, err
+			}
+			refreshed += numRows
+		}
+		cancel()
+
+		if count < batchSize {
+			return refreshed, nil
+		}
+	}
+}
+
+// RefreshScores recomputes the hot and top rankings in the quote_scores materialized view. The
+// refresh runs concurrently so sorting by score keeps working while it is in progress.
+func (m *QuoteDatabaseModel) RefreshScores() error {
+	query := `REFRESH MATERIALIZED VIEW CONCURRENTLY quote_scores`
+
+	// the refresh rescans the likes table so give it longer than the usual queries
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query)
+	return err
+}
+
+// PublishScheduled publishes every scheduled quote whose publish time has passed and returns the
+// quotes it published
+func (m *QuoteDatabaseModel) PublishScheduled() ([]*Quote, error) {
+	query := fmt.Sprintf(`
+		UPDATE quotes
+		SET status = 'published', version = version + 1
+		WHERE status = 'scheduled' AND publish_at <= NOW()
+		RETURNING %s`, quoteColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quotes []*Quote
+	for rows.Next() {
+		var quote Quote
+		if err := rows.Scan(quote.scanDest()...); err != nil {
+			return nil, err
+		}
+		quotes = append(quotes, &quote)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return quotes, nil
 }
 
 func (m *QuoteDatabaseModel) Delete(id int64) error {
@@ -294,3 +918,119 @@ func (m *QuoteDatabaseModel) Delete(id int64) error {
 	}
 	return nil
 }
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FeedCursor marks the position of the last quote on a page of the feed. The next page starts
+// with the quotes that come after it in feed order.
+type FeedCursor struct {
+	Time time.Time
+	ID   int64
+}
+
+// feedTime is when a quote appears in the feed, quotes that were scheduled or published after being
+// saved as drafts are placed at their publish time rather than when they were written. It must match
+// the expression in quotes_user_id_feed_idx.
+const feedTime = "COALESCE(quotes.publish_at, quotes.created_at)"
+
+// Encode returns the cursor as an opaque string for clients to send back
+func (c FeedCursor) Encode() string {
+	raw := strconv.FormatInt(c.Time.Unix(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeFeedCursor parses a cursor returned by FeedCursor.Encode
+func DecodeFeedCursor(s string) (FeedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return FeedCursor{}, ErrInvalidCursor
+	}
+
+	seconds, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return FeedCursor{}, ErrInvalidCursor
+	}
+
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return FeedCursor{}, ErrInvalidCursor
+	}
+
+	cursor := FeedCursor{Time: time.Unix(unix, 0)}
+	cursor.ID, err = strconv.ParseInt(id, 10, 64)
+	if err != nil || cursor.ID < 1 {
+		return FeedCursor{}, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// GetFeed returns up to limit of the most recent quotes listable by the user from the users they
+// follow, starting after the cursor if one is given. The returned cursor is nil on the last page.
+//
+// Each followed user's quotes are read newest first from quotes_user_id_feed_idx and merged, so
+// the cost grows with the number of followed users times the page size rather than with the
+// number of quotes they have written.
+func (m *QuoteDatabaseModel) GetFeed(userID int64, after *FeedCursor, limit int) ([]*Quote, *FeedCursor, error) {
+	var afterTime *time.Time
+	var afterID int64
+	if after != nil {
+		afterTime, afterID = &after.Time, after.ID
+	}
+
+	query := fmt.Sprintf(`
+		SELECT feed.*
+		FROM follows
+		CROSS JOIN LATERAL (
+			SELECT %[1]s, my_like.val, %[2]s AS feed_time
+			FROM quotes
+			%[3]s
+			WHERE quotes.user_id = follows.followee_id
+			AND %[4]s
+			AND ($2::timestamptz IS NULL OR (%[2]s, quotes.id) < ($2, $3))
+			ORDER BY %[2]s DESC, quotes.id DESC
+			LIMIT $4
+		) AS feed
+		WHERE follows.follower_id = $1
+		ORDER BY feed.feed_time DESC, feed.id DESC
+		LIMIT $4`, quoteColumns, feedTime, myReactionJoin("$1"), listableBy("$1"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// one extra row tells us whether there is another page
+	rows, err := m.DB.QueryContext(ctx, query, userID, afterTime, afterID, limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	quotes := []*Quote{}
+	feedTimes := []time.Time{}
+
+	for rows.Next() {
+		var quote Quote
+		var quoteFeedTime time.Time
+		err := rows.Scan(append(quote.scanDest(), &quote.MyReaction, &quoteFeedTime)...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		quotes = append(quotes, &quote)
+		feedTimes = append(feedTimes, quoteFeedTime)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(quotes) <= limit {
+		return quotes, nil, nil
+	}
+
+	quotes = quotes[:limit]
+	next := FeedCursor{Time: feedTimes[limit-1], ID: quotes[limit-1].ID}
+
+	return quotes, &next, nil
+}
@@ -0,0 +1,456 @@
+package data
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+func TestContentFingerprint(t *testing.T) {
+	tests := []struct {
+		name  string
+		a     string
+		b     string
+		equal bool
+	}{
+		{
+			name:  "case",
+			a:     "Be yourself; everyone else is already taken.",
+			b:     "be yourself; EVERYONE else is already taken.",
+			equal: true,
+		},
+		{
+			name:  "smart quotes and punctuation",
+			a:     "“Don’t cry because it’s over, smile because it happened.”",
+			b:     "\"Don't cry because it's over - smile because it happened\"",
+			equal: true,
+		},
+		{
+			name:  "whitespace",
+			a:     "  So many books,\n so little   time. ",
+			b:     "So many books, so little time.",
+			equal: true,
+		},
+		{
+			name:  "different words",
+			a:     "So many books, so little time.",
+			b:     "So many books, so much time.",
+			equal: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, ContentFingerprint(test.a) == ContentFingerprint(test.b), test.equal)
+		})
+	}
+}
+
+func TestContentFingerprintWithoutLettersOrDigits(t *testing.T) {
+	for _, content := range []string{"", "!!!", " “…” "} {
+		assert.Equal(t, ContentFingerprint(content), "")
+	}
+}
+
+func TestRefreshFingerprints(t *testing.T) {
+	db := newTestDB(t)
+	quotes := QuoteDatabaseModel{DB: db}
+
+	userID := insertTestUser(t, db)
+	quoteID := insertTestQuote(t, db, userID)
+
+	punctuation := &Quote{
+		UserID:     userID,
+		Content:    "!!!",
+		Author:     "Tester",
+		Tags:       []string{"test"},
+		Visibility: VisibilityPublic,
+		Status:     StatusPublished,
+	}
+	err := quotes.Insert(punctuation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// content without letters or digits is never a duplicate
+	_, err = quotes.FindDuplicate("?!", userID, 0)
+	assert.Equal(t, err, ErrRecordNotFound)
+
+	// stand in for a fingerprint the SQL backfill computed differently
+	_, err = db.Exec("UPDATE quotes SET content_fingerprint = 'stale' WHERE id = $1", quoteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refreshed, err := quotes.RefreshFingerprints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed < 1 {
+		t.Errorf("expected at least 1 refreshed quote; got %d", refreshed)
+	}
+
+	duplicate, err := quotes.FindDuplicate("a TEST quote!", userID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, duplicate.ID <= quoteID, true)
+
+}
+
+func TestFindDuplicateExcludesQuote(t *testing.T) {
+	db := newTestDB(t)
+	quotes := QuoteDatabaseModel{DB: db}
+
+	userID := insertTestUser(t, db)
+	content := fmt.Sprintf("Only said once %d", time.Now().UnixNano())
+	quoteID := insertTestQuoteWith(t, db, &Quote{UserID: userID, Content: content})
+
+	duplicate, err := quotes.FindDuplicate(content, userID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, duplicate.ID, quoteID)
+
+	// a quote being edited isn't a duplicate of itself
+	_, err = quotes.FindDuplicate(content, userID, quoteID)
+	assert.Equal(t, err, ErrRecordNotFound)
+}
+
+func TestNormaliseQuote(t *testing.T) {
+	quote := Quote{
+		// "e" followed by a combining acute accent
+		Content: "  Cafe\u0301 society  \n",
+		Author:  " Anonymous ",
+		Tags:    []string{" life ", "cafe\u0301"},
+	}
+
+	NormaliseQuote(&quote)
+
+	assert.Equal(t, quote.Content, "Caf\u00e9 society")
+	assert.Equal(t, quote.Author, "Anonymous")
+	assert.Equal(t, quote.Tags[0], "life")
+	assert.Equal(t, quote.Tags[1], "caf\u00e9")
+}
+
+func TestValidateQuoteContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{name: "empty", content: "", valid: false},
+		{name: "multi-line", content: "first line\nsecond line", valid: true},
+		{name: "control character", content: "ring the bell\a", valid: false},
+		{name: "299 multi-byte characters", content: strings.Repeat("é", 299), valid: true},
+		{name: "300 characters", content: strings.Repeat("a", 300), valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateQuote(v, &Quote{Content: test.content, Author: "author", Tags: []string{"tag"}})
+			_, hasErr := v.Errors["content"]
+			assert.Equal(t, hasErr, !test.valid)
+		})
+	}
+}
+
+func TestQuoteVisibility(t *testing.T) {
+	db := newTestDB(t)
+	quotes := QuoteDatabaseModel{DB: db}
+
+	ownerID := insertTestUser(t, db)
+	otherID := insertTestUser(t, db)
+
+	// a tag of their own keeps the owner's quotes apart from everything else in GetAll
+	tag := fmt.Sprintf("visibility-%d", ownerID)
+
+	ids := make(map[string]int64)
+	for _, visibility := range Visibilities {
+		ids[visibility] = insertTestQuoteWith(t, db, &Quote{UserID: ownerID, Tags: []string{tag}, Visibility: visibility})
+	}
+
+	filters := Filters{Page: 1, PageSize: 10, Sort: "id", SortSafeList: []string{"id"}}
+
+	tests := []struct {
+		name     string
+		viewerID int64
+		// the visibilities of the quotes the viewer can get by ID
+		gettable []string
+		// the visibilities of the quotes the viewer sees in listings
+		listed []string
+	}{
+		{
+			name:     "owner",
+			viewerID: ownerID,
+			gettable: []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate},
+			listed:   []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate},
+		},
+		{
+			name:     "other user",
+			viewerID: otherID,
+			gettable: []string{VisibilityPublic, VisibilityUnlisted},
+			listed:   []string{VisibilityPublic},
+		},
+		{
+			name:     "anonymous",
+			viewerID: AnonymousUser.ID,
+			gettable: []string{VisibilityPublic, VisibilityUnlisted},
+			listed:   []string{VisibilityPublic},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, visibility := range Visibilities {
+				_, err := quotes.Get(ids[visibility], test.viewerID)
+				if slices.Contains(test.gettable, visibility) {
+					assert.Equal(t, err, nil)
+				} else {
+					assert.Equal(t, err, ErrRecordNotFound)
+				}
+			}
+
+			want := make([]int64, len(test.listed))
+			for i, visibility := range test.listed {
+				want[i] = ids[visibility]
+			}
+
+			all, _, err := quotes.GetAll(test.viewerID, QuoteSearch{Tags: []string{tag}}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, fmt.Sprint(quoteIDs(all)), fmt.Sprint(want))
+
+			owned, _, err := quotes.GetAllForUser(ownerID, test.viewerID, QuoteSearch{}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, fmt.Sprint(quoteIDs(owned)), fmt.Sprint(want))
+		})
+	}
+}
+
+func quoteIDs(quotes []*Quote) []int64 {
+	ids := make([]int64, len(quotes))
+	for i, quote := range quotes {
+		ids[i] = quote.ID
+	}
+	return ids
+}
+
+func TestValidatePublishAt(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		status    string
+		publishAt *time.Time
+		valid     bool
+	}{
+		{name: "scheduled in the future", status: StatusScheduled, publishAt: &future, valid: true},
+		{name: "scheduled in the past", status: StatusScheduled, publishAt: &past, valid: false},
+		{name: "published with a publish time", status: StatusPublished, publishAt: &future, valid: false},
+		{name: "published without a publish time", status: StatusPublished, valid: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := validator.New()
+			ValidatePublishAt(v, &Quote{Status: test.status, PublishAt: test.publishAt})
+			assert.Equal(t, v.Valid(), test.valid)
+		})
+	}
+
+	// a scheduled quote that is waiting for the scheduler is still a valid quote
+	v := validator.New()
+	ValidateQuote(v, &Quote{
+		Content:    "content",
+		Author:     "author",
+		Tags:       []string{"tag"},
+		Visibility: VisibilityPublic,
+		Status:     StatusScheduled,
+		PublishAt:  &past,
+	})
+	assert.Equal(t, v.Valid(), true)
+}
+
+func TestPublishScheduled(t *testing.T) {
+	db := newTestDB(t)
+	quotes := QuoteDatabaseModel{DB: db}
+
+	userID := insertTestUser(t, db)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	dueID := insertTestQuoteWith(t, db, &Quote{UserID: userID, Status: StatusScheduled, PublishAt: &past})
+	laterID := insertTestQuoteWith(t, db, &Quote{UserID: userID, Status: StatusScheduled, PublishAt: &future})
+	draftID := insertTestQuoteWith(t, db, &Quote{UserID: userID, Status: StatusDraft})
+
+	published, err := quotes.PublishScheduled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, slices.Contains(quoteIDs(published), dueID), true)
+	assert.Equal(t, slices.Contains(quoteIDs(published), laterID), false)
+	assert.Equal(t, slices.Contains(quoteIDs(published), draftID), false)
+
+	statuses := map[int64]string{dueID: StatusPublished, laterID: StatusScheduled, draftID: StatusDraft}
+	for id, status := range statuses {
+		quote, err := quotes.Get(id, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, quote.Status, status)
+	}
+
+	// the published quote is no longer due so running again doesn't publish it twice
+	published, err = quotes.PublishScheduled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, slices.Contains(quoteIDs(published), dueID), false)
+}
+
+func TestQuoteRankings(t *testing.T) {
+	db := newTestDB(t)
+	quotes := QuoteDatabaseModel{DB: db}
+	likes := LikesDatabaseModel{DB: db}
+
+	ownerID := insertTestUser(t, db)
+	tag := fmt.Sprintf("rankings-%d", ownerID)
+
+	// old is liked by three users two weeks ago, recent by one user just now and unvoted by nobody
+	oldID := insertTestQuoteWith(t, db, &Quote{UserID: ownerID, Tags: []string{tag}})
+	recentID := insertTestQuoteWith(t, db, &Quote{UserID: ownerID, Tags: []string{tag}})
+	unvotedID := insertTestQuoteWith(t, db, &Quote{UserID: ownerID, Tags: []string{tag}})
+
+	for i := 0; i < 3; i++ {
+		userID := insertTestUser(t, db)
+		_, err := likes.SetReaction(Like{UserID: userID, QuoteID: oldID, Val: LikeValue})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := db.Exec("UPDATE likes SET created_at = NOW() - interval '2 weeks' WHERE quote_id = $1", oldID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = likes.SetReaction(Like{UserID: insertTestUser(t, db), QuoteID: recentID, Val: LikeValue})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = quotes.RefreshScores()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sort string
+		want []int64
+	}{
+		{sort: "hot", want: []int64{recentID, oldID, unvotedID}},
+		{sort: "top_day", want: []int64{recentID, unvotedID, oldID}},
+		{sort: "top_week", want: []int64{recentID, unvotedID, oldID}},
+		{sort: "top_month", want: []int64{oldID, recentID, unvotedID}},
+		{sort: "top_all", want: []int64{oldID, recentID, unvotedID}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sort, func(t *testing.T) {
+			filters := Filters{Page: 1, PageSize: 10, Sort: test.sort, SortSafeList: []string{test.sort}}
+
+			ranked, _, err := quotes.GetAll(ownerID, QuoteSearch{Tags: []string{tag}}, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, fmt.Sprint(quoteIDs(ranked)), fmt.Sprint(test.want))
+		})
+	}
+}
+
+func TestGetAllLikedBy(t *testing.T) {
+	db := newTestDB(t)
+	quotes := QuoteDatabaseModel{DB: db}
+	likes := LikesDatabaseModel{DB: db}
+
+	userID := insertTestUser(t, db)
+	ownerID := insertTestUser(t, db)
+
+	first := insertTestQuote(t, db, ownerID)
+	second := insertTestQuote(t, db, ownerID)
+	disliked := insertTestQuote(t, db, ownerID)
+	unliked := insertTestQuote(t, db, ownerID)
+	hidden := insertTestQuoteWith(t, db, &Quote{UserID: ownerID, Visibility: VisibilityPrivate})
+
+	reactions := []Like{
+		{UserID: userID, QuoteID: first, Val: LikeValue},
+		{UserID: userID, QuoteID: second, Val: LikeValue},
+		{UserID: userID, QuoteID: disliked, Val: DislikeValue},
+		{UserID: userID, QuoteID: unliked, Val: LikeValue},
+		{UserID: userID, QuoteID: hidden, Val: LikeValue},
+	}
+	for _, reaction := range reactions {
+		_, err := likes.SetReaction(reaction)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := likes.ClearReaction(userID, unliked)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// likes made in the same second would otherwise tie
+	_, err = db.Exec("UPDATE likes SET created_at = NOW() - interval '1 hour' WHERE user_id = $1 AND quote_id = $2", userID, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sort string
+		want []int64
+	}{
+		{sort: "-liked_at", want: []int64{second, first}},
+		{sort: "liked_at", want: []int64{first, second}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sort, func(t *testing.T) {
+			filters := Filters{Page: 1, PageSize: 10, Sort: test.sort, SortSafeList: []string{"liked_at", "-liked_at"}}
+
+			liked, metadata, err := quotes.GetAllLikedBy(userID, filters)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, fmt.Sprint(quoteIDs(liked)), fmt.Sprint(test.want))
+			assert.Equal(t, metadata.TotalRecords, 2)
+			assert.Equal(t, *liked[0].MyReaction, LikeType(LikeValue))
+		})
+	}
+}
+
+func TestFeedCursor(t *testing.T) {
+	cursor := FeedCursor{Time: time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC), ID: 42}
+
+	decoded, err := DecodeFeedCursor(cursor.Encode())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, decoded.Time.Equal(cursor.Time), true)
+	assert.Equal(t, decoded.ID, cursor.ID)
+
+	for _, invalid := range []string{"", "not base64!", "MTIz", "YWJjOjQy", "MTIzOjA"} {
+		_, err := DecodeFeedCursor(invalid)
+		assert.Equal(t, err, ErrInvalidCursor)
+	}
+}
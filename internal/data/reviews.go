@@ -0,0 +1,273 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The recall grades of the SM-2 algorithm: 0 is a complete blackout and 5 a perfect response.
+// Grades below PassingGrade count as forgotten.
+const (
+	MinGrade     = 0
+	MaxGrade     = 5
+	PassingGrade = 3
+)
+
+// MinEaseFactor stops cards that are often forgotten from being shown ever more often
+const MinEaseFactor = 1.3
+
+// ReviewCard is a quote that a user is memorising along with when they should next review it
+type ReviewCard struct {
+	UserID         int64      `json:"-"`
+	QuoteID        int64      `json:"quote_id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EaseFactor     float64    `json:"ease_factor"`
+	IntervalDays   int        `json:"interval_days"`
+	Repetitions    int        `json:"repetitions"`
+	DueAt          time.Time  `json:"due_at"`
+	LastReviewedAt *time.Time `json:"last_reviewed_at"`
+	// only set when the card is listed for review or exported
+	Quote *Quote `json:"quote,omitempty"`
+}
+
+// Review reschedules the card with the SM-2 algorithm after the user recalled it with the given
+// grade. Remembered cards are shown after 1 day, then 6 days and then at intervals growing by the
+// ease factor, which goes up or down with the grade. Forgotten cards start again from 1 day and
+// keep their ease factor.
+func (c *ReviewCard) Review(grade int, now time.Time) {
+	if grade >= PassingGrade {
+		switch c.Repetitions {
+		case 0:
+			c.IntervalDays = 1
+		case 1:
+			c.IntervalDays = 6
+		default:
+			c.IntervalDays = int(math.Round(float64(c.IntervalDays) * c.EaseFactor))
+		}
+		c.Repetitions++
+
+		miss := float64(MaxGrade - grade)
+		c.EaseFactor = math.Max(MinEaseFactor, c.EaseFactor+0.1-miss*(0.08+miss*0.02))
+	} else {
+		c.Repetitions = 0
+		c.IntervalDays = 1
+	}
+
+	c.DueAt = now.AddDate(0, 0, c.IntervalDays)
+	c.LastReviewedAt = &now
+}
+
+type ReviewDatabaseModel struct {
+	DB DBTX
+}
+
+const reviewCardColumns = `review_cards.user_id, review_cards.quote_id, review_cards.created_at,
+	review_cards.ease_factor, review_cards.interval_days, review_cards.repetitions,
+	review_cards.due_at, review_cards.last_reviewed_at`
+
+func (c *ReviewCard) scanDest() []interface{} {
+	return []interface{}{
+		&c.UserID,
+		&c.QuoteID,
+		&c.CreatedAt,
+		&c.EaseFactor,
+		&c.IntervalDays,
+		&c.Repetitions,
+		&c.DueAt,
+		&c.LastReviewedAt,
+	}
+}
+
+// EnrolLiked adds the quotes the user has liked to their reviews, or only the given ones if
+// quoteIDs isn't empty. Quotes that are already enrolled keep their schedule. It returns how many
+// quotes were added.
+func (m *ReviewDatabaseModel) EnrolLiked(userID int64, quoteIDs []int64) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO review_cards (user_id, quote_id)
+		SELECT $1::bigint, quotes.id
+		FROM quotes
+		%s
+		WHERE my_like.val = %d
+		AND (cardinality($2::bigint[]) = 0 OR quotes.id = ANY($2))
+		AND %s
+		ON CONFLICT DO NOTHING`, myReactionJoin("$1"), LikeValue, viewableBy("$1"))
+
+	return m.enrol(query, userID, quoteIDs)
+}
+
+// EnrolCollection adds the quotes in the collection to the user's reviews like EnrolLiked. The
+// caller must check that the user can see the collection.
+func (m *ReviewDatabaseModel) EnrolCollection(userID, collectionID int64, quoteIDs []int64) (int64, error) {
+	query := fmt.Sprintf(`
+		INSERT INTO review_cards (user_id, quote_id)
+		SELECT $1::bigint, quotes.id
+		FROM collection_quotes
+		INNER JOIN quotes ON quotes.id = collection_quotes.quote_id
+		WHERE collection_quotes.collection_id = $3
+		AND (cardinality($2::bigint[]) = 0 OR quotes.id = ANY($2))
+		AND %s
+		ON CONFLICT DO NOTHING`, viewableBy("$1"))
+
+	return m.enrol(query, userID, quoteIDs, collectionID)
+}
+
+// enrol runs one of the enrolment queries, which take the user ID and quote IDs as $1 and $2
+func (m *ReviewDatabaseModel) enrol(query string, userID int64, quoteIDs []int64, args ...interface{}) (int64, error) {
+	if quoteIDs == nil {
+		quoteIDs = []int64{}
+	}
+	args = append([]interface{}{userID, pq.Array(quoteIDs)}, args...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, translateError(err)
+	}
+
+	return res.RowsAffected()
+}
+
+// Get returns the user's card for the quote, without the quote
+func (m *ReviewDatabaseModel) Get(userID, quoteID int64) (*ReviewCard, error) {
+	query := `
+		SELECT ` + reviewCardColumns + `
+		FROM review_cards
+		WHERE user_id = $1 AND quote_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var card ReviewCard
+
+	err := m.DB.QueryRowContext(ctx, query, userID, quoteID).Scan(card.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &card, nil
+}
+
+// GetDue lists up to limit of the user's cards that are due before the given time, most overdue
+// first, along with their quotes. Cards whose quotes the user can no longer see are left out.
+func (m *ReviewDatabaseModel) GetDue(userID int64, before time.Time, limit int) ([]*ReviewCard, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM review_cards
+		INNER JOIN quotes ON quotes.id = review_cards.quote_id
+		WHERE review_cards.user_id = $1 AND review_cards.due_at < $2
+		AND %s
+		ORDER BY review_cards.due_at ASC, review_cards.quote_id ASC
+		LIMIT $3`, reviewCardColumns, quoteColumns, viewableBy("$1"))
+
+	return m.listWithQuotes(query, userID, before, limit)
+}
+
+// GetAllForUser lists all of the user's cards along with their quotes in the order they were
+// enrolled
+func (m *ReviewDatabaseModel) GetAllForUser(userID int64) ([]*ReviewCard, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, %s
+		FROM review_cards
+		INNER JOIN quotes ON quotes.id = review_cards.quote_id
+		WHERE review_cards.user_id = $1
+		AND %s
+		ORDER BY review_cards.created_at ASC, review_cards.quote_id ASC`, reviewCardColumns, quoteColumns, viewableBy("$1"))
+
+	return m.listWithQuotes(query, userID)
+}
+
+// listWithQuotes runs a query whose rows are reviewCardColumns followed by quoteColumns
+func (m *ReviewDatabaseModel) listWithQuotes(query string, args ...interface{}) ([]*ReviewCard, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	cards := []*ReviewCard{}
+
+	for rows.Next() {
+		card := ReviewCard{Quote: &Quote{}}
+		err := rows.Scan(append(card.scanDest(), card.Quote.scanDest()...)...)
+		if err != nil {
+			return nil, err
+		}
+
+		cards = append(cards, &card)
+	}
+
+	return cards, rows.Err()
+}
+
+// Update stores the card's new schedule
+func (m *ReviewDatabaseModel) Update(card *ReviewCard) error {
+	query := `
+		UPDATE review_cards
+		SET ease_factor = $3, interval_days = $4, repetitions = $5, due_at = $6, last_reviewed_at = $7
+		WHERE user_id = $1 AND quote_id = $2`
+
+	args := []interface{}{
+		card.UserID,
+		card.QuoteID,
+		card.EaseFactor,
+		card.IntervalDays,
+		card.Repetitions,
+		card.DueAt,
+		card.LastReviewedAt,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Delete stops the user reviewing the quote
+func (m *ReviewDatabaseModel) Delete(userID, quoteID int64) error {
+	query := `
+		DELETE FROM review_cards WHERE user_id = $1 AND quote_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, userID, quoteID)
+	if err != nil {
+		return err
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+func TestReviewCardReview(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	card := ReviewCard{EaseFactor: 2.5}
+
+	// the first two successful reviews are always 1 and 6 days apart
+	card.Review(4, now)
+	assert.Equal(t, card.IntervalDays, 1)
+	assert.Equal(t, card.Repetitions, 1)
+	assert.Equal(t, card.EaseFactor, 2.5)
+	assert.Equal(t, card.DueAt.Equal(now.AddDate(0, 0, 1)), true)
+	assert.Equal(t, card.LastReviewedAt.Equal(now), true)
+
+	card.Review(5, now)
+	assert.Equal(t, card.IntervalDays, 6)
+	assert.Equal(t, card.Repetitions, 2)
+	assert.Equal(t, card.EaseFactor, 2.6)
+
+	// after that the interval grows by the ease factor
+	card.Review(3, now)
+	assert.Equal(t, card.IntervalDays, 16)
+	assert.Equal(t, card.Repetitions, 3)
+	assert.Equal(t, card.EaseFactor > 2.45 && card.EaseFactor < 2.47, true)
+
+	// forgetting starts the schedule again without changing the ease factor
+	ease := card.EaseFactor
+	card.Review(1, now)
+	assert.Equal(t, card.IntervalDays, 1)
+	assert.Equal(t, card.Repetitions, 0)
+	assert.Equal(t, card.EaseFactor, ease)
+	assert.Equal(t, card.DueAt.Equal(now.AddDate(0, 0, 1)), true)
+}
+
+func TestReviewCardMinEaseFactor(t *testing.T) {
+	card := ReviewCard{EaseFactor: 1.4, Repetitions: 2, IntervalDays: 10}
+
+	card.Review(3, time.Now())
+	assert.Equal(t, card.EaseFactor, MinEaseFactor)
+	assert.Equal(t, card.IntervalDays, 14)
+}
@@ -0,0 +1,249 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/lib/pq"
+)
+
+// How users are told about new quotes matching a saved search. They must match
+// saved_searches_alert_check.
+const (
+	AlertInApp = "in_app"
+	AlertEmail = "email"
+	AlertNone  = "none"
+)
+
+var SavedSearchAlerts = []string{AlertInApp, AlertEmail, AlertNone}
+
+// MaxSavedSearches is how many saved searches each user can have
+const MaxSavedSearches = 25
+
+var ErrTooManySavedSearches = errors.New("too many saved searches")
+
+// SavedSearch is a quote search kept by a user so that it can be run again and so that they can be
+// alerted when new quotes match it
+type SavedSearch struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"-"`
+	Name      string    `json:"name"`
+	QuoteSearch
+	Alert string `json:"alert"`
+}
+
+type SavedSearchDatabaseModel struct {
+	DB DBTX
+}
+
+func NormaliseSavedSearch(search *SavedSearch) {
+	search.Name = normaliseText(search.Name)
+	search.Content = normaliseText(search.Content)
+	search.Author = normaliseText(search.Author)
+
+	for i := range search.Tags {
+		search.Tags[i] = normaliseText(search.Tags[i])
+	}
+}
+
+// the length limits are in characters to match the LENGTH() checks in migration 000026
+func ValidateSavedSearch(v *validator.Validator, search *SavedSearch) {
+	v.Check(search.Name != "", "name", "must be provided")
+	v.Check(utf8.RuneCountInString(search.Name) <= 100, "name", "must not be more than 100 characters")
+	v.Check(validator.NoControlChars(search.Name), "name", "must not contain control characters")
+
+	// a search without criteria would alert on every quote
+	v.Check(search.Content != "" || search.Author != "" || len(search.Tags) > 0, "search", "content, author or tags must be provided")
+
+	v.Check(utf8.RuneCountInString(search.Content) < 300, "content", "must be less than 300 characters")
+	v.Check(validator.NoControlChars(search.Content), "content", "must not contain control characters")
+
+	v.Check(utf8.RuneCountInString(search.Author) < 100, "author", "must be less than 100 characters")
+	v.Check(validator.NoControlChars(search.Author), "author", "must not contain control characters")
+
+	v.Check(len(search.Tags) <= 10, "tags", "must not contain more than 10 tags")
+	for _, tag := range search.Tags {
+		v.Check(tag != "", "tags", "must not contain empty values")
+		v.Check(validator.NoControlChars(tag), "tags", "must not contain control characters")
+	}
+	v.Check(validator.Unique(search.Tags), "tags", "must not contain duplicate values")
+
+	v.Check(validator.In(search.Alert, SavedSearchAlerts...), "alert", "must be one of in_app, email or none")
+}
+
+const savedSearchColumns = `saved_searches.id, saved_searches.created_at, saved_searches.user_id,
+	saved_searches.name, saved_searches.content, saved_searches.author, saved_searches.tags,
+	saved_searches.alert`
+
+func (s *SavedSearch) scanDest() []interface{} {
+	return []interface{}{
+		&s.ID,
+		&s.CreatedAt,
+		&s.UserID,
+		&s.Name,
+		&s.Content,
+		&s.Author,
+		pq.Array(&s.Tags),
+		&s.Alert,
+	}
+}
+
+// Insert stores the search unless the user already has MaxSavedSearches of them, in which case
+// ErrTooManySavedSearches is returned
+func (m *SavedSearchDatabaseModel) Insert(search *SavedSearch) error {
+	query := `
+		INSERT INTO saved_searches (user_id, name, content, author, tags, alert)
+		SELECT $1::bigint, $2::text, $3::text, $4::text, $5::text[], $6::text
+		WHERE (SELECT count(*) FROM saved_searches WHERE user_id = $1) < $7
+		RETURNING id, created_at`
+
+	if search.Tags == nil {
+		search.Tags = []string{}
+	}
+
+	args := []interface{}{
+		search.UserID,
+		search.Name,
+		search.Content,
+		search.Author,
+		pq.Array(search.Tags),
+		search.Alert,
+		MaxSavedSearches,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&search.ID, &search.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTooManySavedSearches
+	}
+	return translateError(err)
+}
+
+// Get returns the saved search if it belongs to the user
+func (m *SavedSearchDatabaseModel) Get(id, userID int64) (*SavedSearch, error) {
+	query := `
+		SELECT ` + savedSearchColumns + `
+		FROM saved_searches
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var search SavedSearch
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(search.scanDest()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &search, nil
+}
+
+func (m *SavedSearchDatabaseModel) GetAllForUser(userID int64) ([]*SavedSearch, error) {
+	query := `
+		SELECT ` + savedSearchColumns + `
+		FROM saved_searches
+		WHERE user_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanSavedSearches(rows)
+}
+
+func (m *SavedSearchDatabaseModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM saved_searches WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Match finds the saved searches with alerts turned on that the quote matches and records the
+// matches. Each search is only returned the first time it matches a quote, so a quote that is
+// matched again, such as after being made private and public again, doesn't alert anyone twice.
+// The quote is only matched against searches of users who can see it in listings, other than its
+// owner. The conditions mirror QuoteSearch.where with the criteria read from the saved search.
+func (m *SavedSearchDatabaseModel) Match(quoteID int64) ([]*SavedSearch, error) {
+	query := fmt.Sprintf(`
+		WITH matched AS (
+			INSERT INTO saved_search_matches (saved_search_id, quote_id)
+			SELECT saved_searches.id, quotes.id
+			FROM quotes
+			INNER JOIN saved_searches ON saved_searches.tags <@ quotes.tags
+			WHERE quotes.id = $1
+			AND saved_searches.alert != 'none'
+			AND saved_searches.user_id != quotes.user_id
+			AND (saved_searches.content = '' OR to_tsvector('english', quotes.content) @@ plainto_tsquery('english', saved_searches.content))
+			AND (saved_searches.author = '' OR lower(quotes.author) = lower(saved_searches.author))
+			AND %s
+			ON CONFLICT DO NOTHING
+			RETURNING saved_search_id
+		)
+		SELECT %s
+		FROM saved_searches
+		INNER JOIN matched ON matched.saved_search_id = saved_searches.id
+		ORDER BY saved_searches.id ASC`, listableBy("saved_searches.user_id"), savedSearchColumns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, quoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanSavedSearches(rows)
+}
+
+func scanSavedSearches(rows *sql.Rows) ([]*SavedSearch, error) {
+	searches := []*SavedSearch{}
+
+	for rows.Next() {
+		var search SavedSearch
+		err := rows.Scan(search.scanDest()...)
+		if err != nil {
+			return nil, err
+		}
+
+		searches = append(searches, &search)
+	}
+
+	return searches, rows.Err()
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+func TestValidateSavedSearch(t *testing.T) {
+	tests := []struct {
+		name   string
+		search SavedSearch
+		field  string
+	}{
+		{name: "valid", search: SavedSearch{Name: "life", QuoteSearch: QuoteSearch{Tags: []string{"life"}}, Alert: AlertInApp}},
+		{name: "no name", search: SavedSearch{QuoteSearch: QuoteSearch{Author: "Seneca"}, Alert: AlertInApp}, field: "name"},
+		{name: "no criteria", search: SavedSearch{Name: "everything", Alert: AlertInApp}, field: "search"},
+		{name: "unknown alert", search: SavedSearch{Name: "life", QuoteSearch: QuoteSearch{Content: "life"}, Alert: "sms"}, field: "alert"},
+		{name: "duplicate tags", search: SavedSearch{Name: "life", QuoteSearch: QuoteSearch{Tags: []string{"life", "life"}}, Alert: AlertNone}, field: "tags"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateSavedSearch(v, &test.search)
+
+			if test.field == "" {
+				assert.Equal(t, v.Valid(), true)
+				return
+			}
+			_, hasErr := v.Errors[test.field]
+			assert.Equal(t, hasErr, true)
+		})
+	}
+}
+
+func TestSavedSearchMatch(t *testing.T) {
+	db := newTestDB(t)
+	searches := SavedSearchDatabaseModel{DB: db}
+
+	searcherID := insertTestUser(t, db)
+	posterID := insertTestUser(t, db)
+
+	matching := &SavedSearch{UserID: searcherID, Name: "tests", QuoteSearch: QuoteSearch{Tags: []string{"test"}}, Alert: AlertInApp}
+	other := &SavedSearch{UserID: searcherID, Name: "other", QuoteSearch: QuoteSearch{Author: "Somebody Else"}, Alert: AlertInApp}
+	muted := &SavedSearch{UserID: searcherID, Name: "muted", QuoteSearch: QuoteSearch{Tags: []string{"test"}}, Alert: AlertNone}
+	for _, search := range []*SavedSearch{matching, other, muted} {
+		err := searches.Insert(search)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	quoteID := insertTestQuote(t, db, posterID)
+
+	matched, err := searches.Match(quoteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(matched), 1)
+	assert.Equal(t, matched[0].ID, matching.ID)
+
+	// a quote only alerts each search once
+	matched, err = searches.Match(quoteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(matched), 0)
+
+	// nor does anyone get alerted about their own quotes
+	ownQuoteID := insertTestQuote(t, db, searcherID)
+
+	matched, err = searches.Match(ownQuoteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(matched), 0)
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StreamChannel is the postgres notification channel that stream events are published on
+const StreamChannel = "stream_events"
+
+// StreamEvent is a change to a public quote that is pushed to clients of the event stream. The
+// quote's owner and tags are kept alongside the event data so that clients can filter on them.
+type StreamEvent struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	QuoteID int64           `json:"quote_id"`
+	UserID  int64           `json:"user_id"`
+	Tags    []string        `json:"tags"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type StreamEventDatabaseModel struct {
+	DB DBTX
+}
+
+// GetSince returns up to limit events with an ID greater than afterID, oldest first
+func (m *StreamEventDatabaseModel) GetSince(afterID int64, limit int) ([]*StreamEvent, error) {
+	query := `
+		SELECT id, type, quote_id, user_id, tags, data
+		FROM stream_events
+		WHERE id > $1
+		ORDER BY id ASC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := []*StreamEvent{}
+
+	for rows.Next() {
+		var event StreamEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.Type,
+			&event.QuoteID,
+			&event.UserID,
+			pq.Array(&event.Tags),
+			&event.Data,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
+
+// Prune deletes the events older than the retention period, after which clients can no longer
+// resume from them
+func (m *StreamEventDatabaseModel) Prune(retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM stream_events
+		WHERE created_at < NOW() - $1::float8 * interval '1 second'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
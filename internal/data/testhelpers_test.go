@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// newTestDB connects to the database named by QUOTABLE_TEST_DB_DSN, which must have every migration
+// applied. Tests using it are skipped when the variable isn't set.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("QUOTABLE_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("QUOTABLE_TEST_DB_DSN not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// insertTestUser inserts an activated user that is deleted, along with everything they own, when
+// the test finishes
+func insertTestUser(t *testing.T, db *sql.DB) int64 {
+	t.Helper()
+
+	var id int64
+	err := db.QueryRow(`
+		INSERT INTO users (username, email, password_hash, activated)
+		VALUES ('test', $1, 'hash', true)
+		RETURNING id`, fmt.Sprintf("test-%d@example.com", time.Now().UnixNano())).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = $1", id) })
+
+	return id
+}
+
+// insertTestQuote inserts a published public quote owned by the user
+func insertTestQuote(t *testing.T, db *sql.DB, userID int64) int64 {
+	t.Helper()
+
+	return insertTestQuoteWith(t, db, &Quote{UserID: userID})
+}
+
+// insertTestQuoteWith inserts the quote after filling in the fields left empty with those of a
+// published public test quote
+func insertTestQuoteWith(t *testing.T, db *sql.DB, quote *Quote) int64 {
+	t.Helper()
+
+	if quote.Content == "" {
+		quote.Content = "A test quote"
+	}
+	if quote.Author == "" {
+		quote.Author = "Tester"
+	}
+	if quote.Tags == nil {
+		quote.Tags = []string{"test"}
+	}
+	if quote.Visibility == "" {
+		quote.Visibility = VisibilityPublic
+	}
+	if quote.Status == "" {
+		quote.Status = StatusPublished
+	}
+
+	quotes := QuoteDatabaseModel{DB: db}
+	err := quotes.Insert(quote)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return quote.ID
+}
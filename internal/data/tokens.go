@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"database/sql"
 	"encoding/base32"
 	"time"
 
@@ -15,6 +14,8 @@ const (
 	// this scope designates that the token is used for activation of a user account
 	ScopeActivation = "activation"
 	ScopeAuth       = "auth"
+	// lets the holder turn off the user's email digests without logging in
+	ScopeUnsubscribe = "unsubscribe"
 )
 
 type Token struct {
@@ -28,7 +29,7 @@ type Token struct {
 type TokenModel interface{}
 
 type TokenDatabaseModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -79,6 +80,19 @@ func (m TokenDatabaseModel) Insert(token *Token) error {
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, args...)
+	return translateError(err)
+}
+
+// Delete removes the token, e.g. when the email carrying it couldn't be sent
+func (m TokenDatabaseModel) Delete(token *Token) error {
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, token.Hash)
 	return err
 }
 
@@ -0,0 +1,65 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrNestedTransaction = errors.New("data: transactions can't be nested")
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx so that models can run their queries either
+// directly or as part of a transaction
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Transaction calls fn with models that run every query in a single transaction. The transaction is
+// committed if fn returns nil and rolled back otherwise, in which case fn's error is returned.
+func (m Models) Transaction(fn func(tx Models) error) error {
+	if m.db == nil {
+		return ErrNestedTransaction
+	}
+
+	tx, err := m.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+
+	// the rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = fn(newModels(tx))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withTx calls fn with a transaction of its own when db is a *sql.DB, committing it if fn returns
+// nil. Models that are already part of a transaction pass it to fn as it is, so methods needing
+// several queries to be atomic can be used both on their own and within Transaction.
+func withTx(ctx context.Context, db DBTX, fn func(tx DBTX) error) error {
+	sqlDB, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db)
+	}
+
+	tx, err := sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// the rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,72 @@
+package data
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+func TestTransactionRollsBack(t *testing.T) {
+	db := newTestDB(t)
+	models := New(db)
+	userID := insertTestUser(t, db)
+
+	errAbort := errors.New("abort")
+	err := models.Transaction(func(tx Models) error {
+		err := tx.Permissions.AddForUser(userID, "quotes:read")
+		if err != nil {
+			return err
+		}
+
+		// models that are already in a transaction can't start another
+		assert.Equal(t, tx.Transaction(func(Models) error { return nil }), ErrNestedTransaction)
+
+		return errAbort
+	})
+	assert.Equal(t, err, errAbort)
+
+	permissions, err := models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(permissions), 0)
+}
+
+func TestTransactionLikesAndCollections(t *testing.T) {
+	db := newTestDB(t)
+	models := New(db)
+	userID := insertTestUser(t, db)
+	quoteID := insertTestQuote(t, db, userID)
+
+	collection := &Collection{UserID: userID, Name: "favourites", Visibility: VisibilityPublic}
+	err := models.Collections.Insert(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errAbort := errors.New("abort")
+	err = models.Transaction(func(tx Models) error {
+		_, err := tx.Like.SetReaction(Like{UserID: userID, QuoteID: quoteID, Val: LikeValue})
+		if err != nil {
+			return err
+		}
+
+		err = tx.Collections.AddQuote(collection.ID, quoteID)
+		if err != nil {
+			return err
+		}
+
+		return errAbort
+	})
+	assert.Equal(t, err, errAbort)
+
+	// both changes were made on the transaction and rolled back with it
+	var reactions int
+	err = db.QueryRow("SELECT count(*) FROM likes WHERE quote_id = $1", quoteID).Scan(&reactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, reactions, 0)
+	assert.Equal(t, len(collectionOrder(t, db, collection.ID)), 0)
+}
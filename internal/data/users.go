@@ -5,18 +5,22 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/WanderingAura/quotable/internal/validator"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var (
-	ErrDuplicateEmail = errors.New("duplicate email")
-)
-
 var AnonymousUser = &User{}
 
+// DefaultLocale is used for users who haven't chosen a locale
+const DefaultLocale = "en"
+
+// LocaleRX matches lowercase language tags such as en, fr or pt-br, it must match users_locale_check
+var LocaleRX = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
 func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
@@ -28,6 +32,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Locale    string    `json:"locale"`
 	Version   int       `json:"-"`
 }
 
@@ -39,7 +44,7 @@ type UserModel interface {
 }
 
 type UserDatabaseModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
 type password struct {
@@ -83,11 +88,25 @@ func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
 
+// NormaliseLocale lowercases the locale so that en-GB and en-gb are the same, and uses
+// DefaultLocale if none was given
+func NormaliseLocale(locale string) string {
+	if locale == "" {
+		return DefaultLocale
+	}
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+func ValidateLocale(v *validator.Validator, locale string) {
+	v.Check(validator.Matches(locale, LocaleRX), "locale", "must be a language tag such as en or pt-br")
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.Username != "", "username", "must be provided")
 	v.Check(len(user.Username) <= 500, "username", "must not be more than 500 bytes long")
 
 	ValidateEmail(v, user.Email)
+	ValidateLocale(v, user.Locale)
 
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
@@ -100,30 +119,54 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 func (m *UserDatabaseModel) Insert(user *User) error {
 	query := `
-		INSERT INTO users (username, email, password_hash, activated)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (username, email, password_hash, activated, locale)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at, version`
 
-	args := []interface{}{user.Username, user.Email, user.Password.hash, user.Activated}
+	args := []interface{}{user.Username, user.Email, user.Password.hash, user.Activated, user.Locale}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	return translateError(err)
+}
+
+func (m *UserDatabaseModel) Get(id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, username, email, password_hash, activated, locale, version
+		FROM users
+		WHERE id = $1`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Locale,
+		&user.Version,
+	)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
 		default:
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return &user, nil
 }
 
 func (m *UserDatabaseModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, username, email, password_hash, activated, version
+		SELECT id, created_at, username, email, password_hash, activated, locale, version
 		FROM users
 		WHERE email = $1`
 
@@ -139,6 +182,7 @@ func (m *UserDatabaseModel) GetByEmail(email string) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 	if err != nil {
@@ -155,8 +199,8 @@ func (m *UserDatabaseModel) GetByEmail(email string) (*User, error) {
 func (m *UserDatabaseModel) Update(user *User) error {
 	query := `
 		UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET username = $1, email = $2, password_hash = $3, activated = $4, locale = $5, version = version + 1
+		WHERE id = $6 AND version = $7
 		RETURNING version`
 
 	args := []interface{}{
@@ -164,6 +208,7 @@ func (m *UserDatabaseModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Locale,
 		user.ID,
 		user.Version,
 	}
@@ -174,12 +219,10 @@ func (m *UserDatabaseModel) Update(user *User) error {
 	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unqiue constraint "users_email_key"`:
-			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return translateError(err)
 		}
 	}
 	return nil
@@ -190,7 +233,7 @@ func (m *UserDatabaseModel) GetForToken(scope, tokenPlaintext string) (*User, er
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-		SELECT users.id, users.created_at, users.username, users.email, users.password_hash, users.activated, users.version FROM users
+		SELECT users.id, users.created_at, users.username, users.email, users.password_hash, users.activated, users.locale, users.version FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
 		WHERE tokens.hash = $1
@@ -211,6 +254,7 @@ func (m *UserDatabaseModel) GetForToken(scope, tokenPlaintext string) (*User, er
 		&user.Email,
 		&user.Password.hash,
 		&user.Activated,
+		&user.Locale,
 		&user.Version,
 	)
 	if err != nil {
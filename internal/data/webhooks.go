@@ -0,0 +1,387 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/validator"
+	"github.com/WanderingAura/quotable/internal/webhook"
+	"github.com/lib/pq"
+)
+
+// The events webhooks can subscribe to. They must match webhooks_events_check.
+const (
+	EventQuoteCreated = "quote.created"
+	EventQuoteUpdated = "quote.updated"
+	EventQuoteDeleted = "quote.deleted"
+	EventQuoteReacted = "quote.reacted"
+)
+
+var WebhookEvents = []string{EventQuoteCreated, EventQuoteUpdated, EventQuoteDeleted, EventQuoteReacted}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+var DeliveryStatuses = []string{DeliveryPending, DeliveryDelivered, DeliveryDead}
+
+type Webhook struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"user_id"`
+	URL       string    `json:"url"`
+	// only shown when the webhook is created
+	Secret   string   `json:"secret,omitempty"`
+	Events   []string `json:"events"`
+	AllUsers bool     `json:"all_users"`
+	Active   bool     `json:"active"`
+}
+
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	ResponseStatus *int            `json:"response_status"`
+	LastError      string          `json:"last_error,omitempty"`
+}
+
+// DueDelivery is a delivery claimed by the delivery worker along with where to send it
+type DueDelivery struct {
+	ID       int64
+	URL      string
+	Secret   string
+	Event    string
+	Payload  []byte
+	Attempts int
+}
+
+type WebhookDatabaseModel struct {
+	DB DBTX
+}
+
+func ValidateWebhook(v *validator.Validator, hook *Webhook) {
+	u, err := url.Parse(hook.URL)
+	v.Check(hook.URL != "", "url", "must be provided")
+	v.Check(len(hook.URL) < 2000, "url", "must be less than 2000 bytes")
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	v.Check(err != nil || webhook.PublicHost(u.Hostname()), "url", "must not point to a local or private address")
+
+	v.Check(len(hook.Events) > 0, "events", "must contain at least 1 event")
+	v.Check(validator.Unique(hook.Events), "events", "must not contain duplicate values")
+	for _, event := range hook.Events {
+		v.Check(validator.In(event, WebhookEvents...), "events", "must only contain quote.created, quote.updated, quote.deleted or quote.reacted")
+	}
+}
+
+// Insert stores the webhook with a newly generated signing secret
+func (m *WebhookDatabaseModel) Insert(webhook *Webhook) error {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return err
+	}
+	webhook.Secret = base64.RawURLEncoding.EncodeToString(secret)
+
+	query := `
+		INSERT INTO webhooks (user_id, url, secret, events, all_users)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, active`
+
+	args := []interface{}{webhook.UserID, webhook.URL, webhook.Secret, pq.Array(webhook.Events), webhook.AllUsers}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.ID, &webhook.CreatedAt, &webhook.Active)
+	return translateError(err)
+}
+
+// Get returns the webhook if it belongs to the user. The secret is left out.
+func (m *WebhookDatabaseModel) Get(id, userID int64) (*Webhook, error) {
+	query := `
+		SELECT id, created_at, user_id, url, events, all_users, active
+		FROM webhooks
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.UserID,
+		&webhook.URL,
+		pq.Array(&webhook.Events),
+		&webhook.AllUsers,
+		&webhook.Active,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+// GetAllForUser lists the user's webhooks without their secrets
+func (m *WebhookDatabaseModel) GetAllForUser(userID int64) ([]*Webhook, error) {
+	query := `
+		SELECT id, created_at, user_id, url, events, all_users, active
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(
+			&webhook.ID,
+			&webhook.CreatedAt,
+			&webhook.UserID,
+			&webhook.URL,
+			pq.Array(&webhook.Events),
+			&webhook.AllUsers,
+			&webhook.Active,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, &webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (m *WebhookDatabaseModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM webhooks WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Enqueue queues a delivery of the payload to every active webhook subscribed to the event that
+// belongs to the owner of the quote or, if the quote is listed, receives events for all users
+func (m *WebhookDatabaseModel) Enqueue(event string, ownerID int64, listed bool, payload []byte) error {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1::text, $3::jsonb
+		FROM webhooks
+		WHERE active AND $1 = ANY(events)
+		AND (user_id = $2 OR (all_users AND $4))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, event, ownerID, payload, listed)
+	return err
+}
+
+// ClaimDue claims up to limit pending deliveries that are due. Claimed deliveries aren't due again
+// until the lease has passed, so a worker that dies part way through a batch only delays them.
+func (m *WebhookDatabaseModel) ClaimDue(limit int, lease time.Duration) ([]*DueDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = NOW() + $2::float8 * interval '1 second'
+		FROM webhooks
+		WHERE webhooks.id = webhook_deliveries.webhook_id
+		AND webhook_deliveries.id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at ASC
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING webhook_deliveries.id, webhooks.url, webhooks.secret, webhook_deliveries.event,
+			webhook_deliveries.payload, webhook_deliveries.attempts`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []*DueDelivery{}
+
+	for rows.Next() {
+		var delivery DueDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.URL,
+			&delivery.Secret,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Attempts,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RecordAttempt stores the outcome of an attempt at the delivery. A failed delivery is retried at
+// retryAt, or marked dead if retryAt is nil.
+func (m *WebhookDatabaseModel) RecordAttempt(id int64, responseStatus int, deliveryErr error, retryAt *time.Time) error {
+	status := DeliveryDelivered
+	lastError := ""
+	if deliveryErr != nil {
+		status = DeliveryPending
+		lastError = deliveryErr.Error()
+		if retryAt == nil {
+			status = DeliveryDead
+		}
+	}
+
+	var response *int
+	if responseStatus != 0 {
+		response = &responseStatus
+	}
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = attempts + 1, last_attempt_at = NOW(),
+			next_attempt_at = COALESCE($3, next_attempt_at), response_status = $4, last_error = $5
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id, status, retryAt, response, lastError)
+	return err
+}
+
+// GetDeliveries lists the deliveries of the webhook newest first, optionally only those with the
+// given status
+func (m *WebhookDatabaseModel) GetDeliveries(webhookID int64, status string, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, webhook_id, event, payload, status, attempts,
+			next_attempt_at, last_attempt_at, response_status, last_error
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		AND ($2 = '' OR status = $2)
+		ORDER BY created_at %s, id %s
+		LIMIT $3 OFFSET $4`, filters.sortDirection(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+
+	var totalRecords int
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.WebhookID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastAttemptAt,
+			&delivery.ResponseStatus,
+			&delivery.LastError,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return deliveries, metadata, nil
+}
+
+// Redeliver queues a dead delivery of the webhook to be tried again from scratch
+func (m *WebhookDatabaseModel) Redeliver(webhookID, deliveryID int64) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+		WHERE id = $1 AND webhook_id = $2 AND status = 'dead'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, query, deliveryID, webhookID)
+	if err != nil {
+		return err
+	}
+	numRows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if numRows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
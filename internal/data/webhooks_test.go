@@ -0,0 +1,92 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+	"github.com/WanderingAura/quotable/internal/validator"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{url: "https://example.com/hooks", valid: true},
+		{url: "http://93.184.216.34:8080/hooks", valid: true},
+		{url: "ftp://example.com/hooks", valid: false},
+		{url: "http://localhost:4000/hooks", valid: false},
+		{url: "http://127.0.0.1/hooks", valid: false},
+		{url: "http://10.0.0.5/hooks", valid: false},
+		{url: "http://169.254.169.254/latest/meta-data", valid: false},
+		{url: "http://[::1]:4000/hooks", valid: false},
+		{url: "http://0.0.0.0/hooks", valid: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			v := validator.New()
+			ValidateWebhook(v, &Webhook{URL: test.url, Events: []string{EventQuoteCreated}})
+			assert.Equal(t, v.Valid(), test.valid)
+		})
+	}
+}
+
+// deliveryCount returns the number of deliveries queued for the webhook
+func deliveryCount(t *testing.T, db *sql.DB, webhookID int64) int {
+	t.Helper()
+
+	var count int
+	err := db.QueryRow("SELECT count(*) FROM webhook_deliveries WHERE webhook_id = $1", webhookID).Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+func TestWebhookEnqueue(t *testing.T) {
+	db := newTestDB(t)
+	webhooks := WebhookDatabaseModel{DB: db}
+
+	ownerID := insertTestUser(t, db)
+	adminID := insertTestUser(t, db)
+	otherID := insertTestUser(t, db)
+
+	insert := func(userID int64, allUsers bool) *Webhook {
+		hook := &Webhook{UserID: userID, URL: "https://example.com/hooks", Events: []string{EventQuoteUpdated}, AllUsers: allUsers}
+		err := webhooks.Insert(hook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hook
+	}
+
+	ownerHook := insert(ownerID, false)
+	adminHook := insert(adminID, true)
+	otherHook := insert(otherID, false)
+
+	// webhooks for all users don't hear about quotes that aren't listed
+	err := webhooks.Enqueue(EventQuoteUpdated, ownerID, false, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, deliveryCount(t, db, ownerHook.ID), 1)
+	assert.Equal(t, deliveryCount(t, db, adminHook.ID), 0)
+
+	err = webhooks.Enqueue(EventQuoteUpdated, ownerID, true, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, deliveryCount(t, db, ownerHook.ID), 2)
+	assert.Equal(t, deliveryCount(t, db, adminHook.ID), 1)
+	assert.Equal(t, deliveryCount(t, db, otherHook.ID), 0)
+
+	// nor about events they aren't subscribed to
+	err = webhooks.Enqueue(EventQuoteDeleted, ownerID, true, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, deliveryCount(t, db, adminHook.ID), 1)
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"sync"
+)
+
+// Capture keeps the emails it is given in memory so that tests can check what would have been sent
+type Capture struct {
+	templates *Templates
+	sender    string
+	mu        sync.Mutex
+	messages  []Message
+}
+
+func NewCapture(templates *Templates, sender string) *Capture {
+	return &Capture{
+		templates: templates,
+		sender:    sender,
+	}
+}
+
+func (m *Capture) Send(recipient, locale, templateName string, data interface{}, headers ...Header) error {
+	msg, err := m.templates.render(m.sender, recipient, templateName, locale, data, headers)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, *msg)
+
+	return nil
+}
+
+// Messages returns the emails sent so far, oldest first
+func (m *Capture) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Message(nil), m.messages...)
+}
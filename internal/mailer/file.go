@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"os"
+	"regexp"
+	"time"
+)
+
+var unsafeFilenameRX = regexp.MustCompile(`[^a-zA-Z0-9@._+-]`)
+
+// File writes every email to a .eml file in a directory instead of sending it, so that they can be
+// opened in a mail client during development
+type File struct {
+	templates *Templates
+	dir       string
+	sender    string
+}
+
+// NewFile creates the directory if it doesn't exist yet
+func NewFile(templates *Templates, dir, sender string) (*File, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		templates: templates,
+		dir:       dir,
+		sender:    sender,
+	}, nil
+}
+
+func (m *File) Send(recipient, locale, templateName string, data interface{}, headers ...Header) error {
+	msg, err := m.templates.render(m.sender, recipient, templateName, locale, data, headers)
+	if err != nil {
+		return err
+	}
+
+	// CreateTemp replaces the * so that emails sent at the same time don't overwrite each other
+	pattern := time.Now().UTC().Format("20060102T150405") + "-" + unsafeFilenameRX.ReplaceAllString(recipient, "_") + "-*.eml"
+	f, err := os.CreateTemp(m.dir, pattern)
+	if err != nil {
+		return err
+	}
+
+	_, err = msg.mime().WriteTo(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// Log only logs the emails it is given, including their plain text body so that links and tokens
+// in them can still be used
+type Log struct {
+	templates *Templates
+	logger    *zerolog.Logger
+	sender    string
+}
+
+func NewLog(templates *Templates, logger *zerolog.Logger, sender string) *Log {
+	return &Log{
+		templates: templates,
+		logger:    logger,
+		sender:    sender,
+	}
+}
+
+func (m *Log) Send(recipient, locale, templateName string, data interface{}, headers ...Header) error {
+	msg, err := m.templates.render(m.sender, recipient, templateName, locale, data, headers)
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info().
+		Str("to", msg.To).
+		Str("template", msg.Template).
+		Str("locale", locale).
+		Str("subject", msg.Subject).
+		Str("body", msg.PlainBody).
+		Msg("email not sent")
+
+	return nil
+}
@@ -1,11 +1,7 @@
 package mailer
 
 import (
-	"bytes"
 	"embed"
-	"fmt"
-	"html/template"
-	"time"
 
 	"github.com/go-mail/mail/v2"
 )
@@ -13,57 +9,40 @@ import (
 //go:embed "templates"
 var templateFS embed.FS
 
-type Mailer struct {
-	dialer *mail.Dialer
-	sender string
+// Mailer sends emails rendered from the templates directory in the recipient's locale. The
+// backend is chosen with the -mailer flag.
+type Mailer interface {
+	Send(recipient, locale, templateName string, data interface{}, headers ...Header) error
 }
 
-func New(host string, port int, username, password, sender string) Mailer {
-	dialer := mail.NewDialer(host, port, username, password)
-	dialer.Timeout = 5 * time.Second
-
-	return Mailer{
-		dialer: dialer,
-		sender: sender,
-	}
+// Header is an extra header set on an email, such as List-Unsubscribe
+type Header struct {
+	Name  string
+	Value string
 }
 
-func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
-	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
-	if err != nil {
-		return err
-	}
-
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return err
-	}
-
-	plainBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(plainBody, "plainBody", data)
-	if err != nil {
-		return err
-	}
-
-	htmlBody := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
-	if err != nil {
-		return err
-	}
-
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
+// Message is a rendered email
+type Message struct {
+	To        string
+	From      string
+	Template  string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+	Headers   []Header
+}
 
-	err = m.dialer.DialAndSend(msg)
-	if err != nil {
-		fmt.Printf("%s", err)
-		return err
+// mime builds the message as it is sent over SMTP
+func (msg *Message) mime() *mail.Message {
+	m := mail.NewMessage()
+	m.SetHeader("To", msg.To)
+	m.SetHeader("From", msg.From)
+	m.SetHeader("Subject", msg.Subject)
+	for _, header := range msg.Headers {
+		m.SetHeader(header.Name, header.Value)
 	}
+	m.SetBody("text/plain", msg.PlainBody)
+	m.AddAlternative("text/html", msg.HTMLBody)
 
-	return nil
+	return m
 }
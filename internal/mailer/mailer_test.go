@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+var welcomeData = map[string]interface{}{
+	"userID":          1,
+	"username":        "alice",
+	"activationToken": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+}
+
+func loadTestTemplates(t *testing.T) *Templates {
+	t.Helper()
+
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return templates
+}
+
+func TestCapture(t *testing.T) {
+	m := NewCapture(loadTestTemplates(t), "Quotable <no-reply@quotable.net>")
+
+	err := m.Send("alice@example.com", "en", "user_welcome", welcomeData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := m.Messages()
+	assert.Equal(t, len(messages), 1)
+	assert.Equal(t, messages[0].To, "alice@example.com")
+	assert.Equal(t, messages[0].Subject, "Welcome to Quotable!")
+	assert.StringContains(t, messages[0].PlainBody, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	assert.StringContains(t, messages[0].HTMLBody, "<p>Dear alice,</p>")
+}
+
+func TestCaptureUnknownTemplate(t *testing.T) {
+	m := NewCapture(loadTestTemplates(t), "Quotable <no-reply@quotable.net>")
+
+	err := m.Send("alice@example.com", "en", "missing", nil)
+	if err == nil {
+		t.Fatal("expected an error for a missing template")
+	}
+	assert.Equal(t, len(m.Messages()), 0)
+}
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "emails")
+
+	m, err := NewFile(loadTestTemplates(t), dir, "Quotable <no-reply@quotable.net>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		err = m.Send("alice/../bob@example.com", "en", "user_welcome", welcomeData)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(files), 2)
+
+	for _, file := range files {
+		assert.Equal(t, strings.HasSuffix(file.Name(), ".eml"), true)
+
+		eml, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.StringContains(t, string(eml), "Subject: Welcome to Quotable!")
+	}
+}
+
+func TestFileHeaders(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := NewFile(loadTestTemplates(t), dir, "Quotable <no-reply@quotable.net>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send("alice@example.com", "en", "user_welcome", welcomeData,
+		Header{Name: "List-Unsubscribe", Value: "<https://example.com/unsubscribe>"},
+		Header{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, len(files), 1)
+
+	eml, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.StringContains(t, string(eml), "List-Unsubscribe: <https://example.com/unsubscribe>")
+	assert.StringContains(t, string(eml), "List-Unsubscribe-Post: List-Unsubscribe=One-Click")
+}
@@ -0,0 +1,34 @@
+package mailer
+
+import (
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+// SMTP sends emails through an SMTP server
+type SMTP struct {
+	templates *Templates
+	dialer    *mail.Dialer
+	sender    string
+}
+
+func NewSMTP(templates *Templates, host string, port int, username, password, sender string) *SMTP {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTP{
+		templates: templates,
+		dialer:    dialer,
+		sender:    sender,
+	}
+}
+
+func (m *SMTP) Send(recipient, locale, templateName string, data interface{}, headers ...Header) error {
+	msg, err := m.templates.render(m.sender, recipient, templateName, locale, data, headers)
+	if err != nil {
+		return err
+	}
+
+	return m.dialer.DialAndSend(msg.mime())
+}
@@ -0,0 +1,138 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownTemplate is returned when rendering a template that doesn't exist
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// the parts every template has to define
+var templateParts = []string{"subject", "plainBody", "htmlBody"}
+
+// Templates holds every email template parsed up front. A template named user_welcome lives in
+// user_welcome.tmpl, and its translations in files such as user_welcome.fr.tmpl.
+type Templates struct {
+	// keyed by template name and then by locale, "" being the untranslated default
+	templates map[string]map[string]*template.Template
+}
+
+// LoadTemplates parses the templates embedded in the binary
+func LoadTemplates() (*Templates, error) {
+	return parseTemplates(templateFS, "templates")
+}
+
+func parseTemplates(fsys fs.FS, dir string) (*Templates, error) {
+	files, err := fs.Glob(fsys, dir+"/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{templates: make(map[string]map[string]*template.Template)}
+
+	for _, file := range files {
+		name, locale, _ := strings.Cut(strings.TrimSuffix(path.Base(file), ".tmpl"), ".")
+
+		tmpl, err := template.New("email").ParseFS(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range templateParts {
+			if tmpl.Lookup(part) == nil {
+				return nil, fmt.Errorf("email template %s doesn't define %q", file, part)
+			}
+		}
+
+		if t.templates[name] == nil {
+			t.templates[name] = make(map[string]*template.Template)
+		}
+		t.templates[name][strings.ToLower(locale)] = tmpl
+	}
+
+	for name, variants := range t.templates {
+		if variants[""] == nil {
+			return nil, fmt.Errorf("email template %s has translations but no %s.tmpl", name, name)
+		}
+	}
+
+	return t, nil
+}
+
+// Names lists the templates in alphabetical order
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(t.templates))
+	for name := range t.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// lookup picks the closest variant of the template for the locale: an exact match, then the
+// language without its region (fr for fr-ca), then the untranslated default. The .tmpl suffix is
+// allowed on the name so that emails queued before the registry existed still send.
+func (t *Templates) lookup(name, locale string) (*template.Template, error) {
+	variants, ok := t.templates[strings.TrimSuffix(name, ".tmpl")]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	locale = strings.ToLower(locale)
+	language, _, _ := strings.Cut(locale, "-")
+
+	for _, candidate := range []string{locale, language} {
+		if tmpl, ok := variants[candidate]; ok && candidate != "" {
+			return tmpl, nil
+		}
+	}
+
+	return variants[""], nil
+}
+
+// Render renders the template in the locale's language. The returned message has no sender or
+// recipient.
+func (t *Templates) Render(name, locale string, data interface{}) (*Message, error) {
+	tmpl, err := t.lookup(name, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]string, len(templateParts))
+	for i, part := range templateParts {
+		buf := new(bytes.Buffer)
+		err = tmpl.ExecuteTemplate(buf, part, data)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = buf.String()
+	}
+
+	return &Message{
+		Template:  name,
+		Subject:   parts[0],
+		PlainBody: parts[1],
+		HTMLBody:  parts[2],
+	}, nil
+}
+
+func (t *Templates) render(sender, recipient, name, locale string, data interface{}, headers []Header) (*Message, error) {
+	msg, err := t.Render(name, locale, data)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.From = sender
+	msg.To = recipient
+	msg.Headers = headers
+
+	return msg, nil
+}
@@ -0,0 +1,86 @@
+package mailer
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+func TestParseTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			files: fstest.MapFS{
+				"templates/hello.tmpl":    {Data: []byte(`{{define "subject"}}Hello{{end}}{{define "plainBody"}}{{end}}{{define "htmlBody"}}{{end}}`)},
+				"templates/hello.fr.tmpl": {Data: []byte(`{{define "subject"}}Bonjour{{end}}{{define "plainBody"}}{{end}}{{define "htmlBody"}}{{end}}`)},
+			},
+		},
+		{
+			name: "missing part",
+			files: fstest.MapFS{
+				"templates/hello.tmpl": {Data: []byte(`{{define "subject"}}Hello{{end}}{{define "plainBody"}}{{end}}`)},
+			},
+			wantErr: true,
+		},
+		{
+			name: "translation without a default",
+			files: fstest.MapFS{
+				"templates/hello.fr.tmpl": {Data: []byte(`{{define "subject"}}Bonjour{{end}}{{define "plainBody"}}{{end}}{{define "htmlBody"}}{{end}}`)},
+			},
+			wantErr: true,
+		},
+		{
+			name: "syntax error",
+			files: fstest.MapFS{
+				"templates/hello.tmpl": {Data: []byte(`{{define "subject"}}Hello`)},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTemplates(tt.files, "templates")
+			assert.Equal(t, err != nil, tt.wantErr)
+		})
+	}
+}
+
+func TestTemplatesLocaleFallback(t *testing.T) {
+	templates, err := parseTemplates(fstest.MapFS{
+		"templates/hello.tmpl":       {Data: []byte(`{{define "subject"}}Hello{{end}}{{define "plainBody"}}{{end}}{{define "htmlBody"}}{{end}}`)},
+		"templates/hello.fr.tmpl":    {Data: []byte(`{{define "subject"}}Bonjour{{end}}{{define "plainBody"}}{{end}}{{define "htmlBody"}}{{end}}`)},
+		"templates/hello.fr-CA.tmpl": {Data: []byte(`{{define "subject"}}Allô{{end}}{{define "plainBody"}}{{end}}{{define "htmlBody"}}{{end}}`)},
+	}, "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"fr-ca", "Allô"},
+		{"fr-be", "Bonjour"},
+		{"fr", "Bonjour"},
+		{"de", "Hello"},
+		{"", "Hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			msg, err := templates.Render("hello", tt.locale, nil)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, msg.Subject, tt.want)
+		})
+	}
+
+	_, err = templates.Render("goodbye", "en", nil)
+	assert.Equal(t, errors.Is(err, ErrUnknownTemplate), true)
+}
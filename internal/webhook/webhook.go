@@ -0,0 +1,191 @@
+// Package webhook signs and sends the event payloads delivered to user registered webhook
+// endpoints.
+//
+// Every request is a POST with the JSON payload as its body and these headers:
+//
+//	X-Quotable-Event: the event name, e.g. quote.created
+//	X-Quotable-Delivery: the ID of the delivery, which stays the same across retries
+//	X-Quotable-Timestamp: the unix time the request was signed at
+//	X-Quotable-Signature: sha256=<hex HMAC-SHA256 of "<timestamp>.<body>" keyed by the secret>
+//
+// Receivers should check the signature with Verify and reject old timestamps to stop replays.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// MaxAttempts is how many times a delivery is tried before it is dead-lettered
+	MaxAttempts = 8
+
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+// ErrPrivateAddress is returned when a webhook URL resolves to an address that isn't reachable
+// from the public internet, so the webhook can't be used to reach internal services
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+type Sender struct {
+	client *http.Client
+}
+
+// New returns a Sender that refuses to connect to addresses PublicAddr doesn't accept. The check
+// happens when dialing, after the host has been resolved, so DNS can't be used to get around it.
+func New(timeout time.Duration) *Sender {
+	return newSender(timeout, false)
+}
+
+// newSender returns a Sender that can be allowed to connect to any address, which tests need to
+// reach receivers on localhost
+func newSender(timeout time.Duration, allowPrivate bool) *Sender {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !PublicAddr(addrPort.Addr()) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// a proxy would be dialed instead of the webhook's address, bypassing the check
+	transport.Proxy = nil
+
+	return &Sender{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			// a redirect could send the signed payload somewhere the user didn't register
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Delivery is a single signed request to a webhook endpoint
+type Delivery struct {
+	ID      int64
+	URL     string
+	Secret  string
+	Event   string
+	Payload []byte
+}
+
+// Send posts the delivery and returns the response status code. Any status outside 2xx is
+// returned along with an error so the caller can retry.
+func (s *Sender) Send(ctx context.Context, delivery Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Quotable-Webhook/1.0")
+	req.Header.Set("X-Quotable-Event", delivery.Event)
+	req.Header.Set("X-Quotable-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Quotable-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Quotable-Signature", "sha256="+Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("webhook endpoint responded with status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// PublicAddr reports whether the address is one webhooks may be sent to, i.e. not a loopback,
+// private, link-local, multicast or unspecified address
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified()
+}
+
+// PublicHost reports whether the host, as returned by url.URL.Hostname, may be a public address.
+// IP literals are checked with PublicAddr and localhost names are rejected. Other names can only
+// be checked once they have been resolved, which the Sender does when it connects.
+func PublicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return true
+	}
+	return PublicAddr(addr)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp and payload keyed by the secret
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the X-Quotable-Signature header value matches the timestamp and payload
+func Verify(secret string, timestamp int64, payload []byte, signature string) bool {
+	expected := "sha256=" + Sign(secret, timestamp, payload)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// Backoff returns how long to wait before retrying a delivery that has failed the given number of
+// times. It doubles with every failure starting from 30 seconds and is capped at 6 hours.
+func Backoff(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+
+	backoff := baseBackoff
+	for i := 1; i < failures; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+
+	return backoff
+}
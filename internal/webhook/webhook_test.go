@@ -0,0 +1,148 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/WanderingAura/quotable/internal/assert"
+)
+
+func TestSend(t *testing.T) {
+	const secret = "s3cret"
+	payload := []byte(`{"event":"quote.created"}`)
+
+	received := make(chan *http.Request, 1)
+	var body []byte
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	sender := newSender(5*time.Second, true)
+
+	status, err := sender.Send(context.Background(), Delivery{
+		ID:      7,
+		URL:     receiver.URL,
+		Secret:  secret,
+		Event:   "quote.created",
+		Payload: payload,
+	})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, status, http.StatusNoContent)
+
+	r := <-received
+	assert.Equal(t, r.Method, http.MethodPost)
+	assert.Equal(t, string(body), string(payload))
+	assert.Equal(t, r.Header.Get("X-Quotable-Event"), "quote.created")
+	assert.Equal(t, r.Header.Get("X-Quotable-Delivery"), "7")
+
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Quotable-Timestamp"), 10, 64)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, Verify(secret, timestamp, body, r.Header.Get("X-Quotable-Signature")), true)
+	assert.Equal(t, Verify("wrong", timestamp, body, r.Header.Get("X-Quotable-Signature")), false)
+	assert.Equal(t, Verify(secret, timestamp+1, body, r.Header.Get("X-Quotable-Signature")), false)
+}
+
+func TestSendFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+			status: http.StatusInternalServerError,
+		},
+		{
+			name: "redirect",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, "http://example.com", http.StatusFound)
+			},
+			status: http.StatusFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			receiver := httptest.NewServer(test.handler)
+			defer receiver.Close()
+
+			status, err := newSender(5*time.Second, true).Send(context.Background(), Delivery{URL: receiver.URL, Payload: []byte("{}")})
+			if err == nil {
+				t.Error("expected an error")
+			}
+			assert.Equal(t, status, test.status)
+		})
+	}
+}
+
+func TestSendPrivateAddress(t *testing.T) {
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	_, err := New(5*time.Second).Send(context.Background(), Delivery{URL: receiver.URL, Payload: []byte("{}")})
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("expected ErrPrivateAddress; got %v", err)
+	}
+	assert.Equal(t, called, false)
+}
+
+func TestPublicHost(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected bool
+	}{
+		{host: "example.com", expected: true},
+		{host: "93.184.216.34", expected: true},
+		{host: "2606:2800:220:1::", expected: true},
+		{host: "localhost", expected: false},
+		{host: "api.LOCALHOST.", expected: false},
+		{host: "127.0.0.1", expected: false},
+		{host: "10.1.2.3", expected: false},
+		{host: "192.168.0.1", expected: false},
+		{host: "169.254.169.254", expected: false},
+		{host: "0.0.0.0", expected: false},
+		{host: "::1", expected: false},
+		{host: "::ffff:127.0.0.1", expected: false},
+		{host: "fe80::1", expected: false},
+		{host: "fd00::1", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.host, func(t *testing.T) {
+			assert.Equal(t, PublicHost(test.host), test.expected)
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 0, expected: 0},
+		{failures: 1, expected: 30 * time.Second},
+		{failures: 2, expected: time.Minute},
+		{failures: 5, expected: 8 * time.Minute},
+		{failures: 20, expected: 6 * time.Hour},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, Backoff(test.failures), test.expected)
+	}
+}
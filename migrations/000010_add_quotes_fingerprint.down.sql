@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS quotes_content_fingerprint_idx;
+ALTER TABLE quotes DROP COLUMN IF EXISTS content_fingerprint;
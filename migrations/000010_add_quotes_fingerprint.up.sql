@@ -0,0 +1,9 @@
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS content_fingerprint text NOT NULL DEFAULT '';
+
+-- backfill existing quotes using the same normalisation as data.ContentFingerprint
+UPDATE quotes SET content_fingerprint = md5(btrim(regexp_replace(
+    regexp_replace(lower(content), '[^[:alnum:][:space:]]', '', 'g'),
+    '[[:space:]]+', ' ', 'g'
+)));
+
+CREATE INDEX IF NOT EXISTS quotes_content_fingerprint_idx ON quotes (content_fingerprint);
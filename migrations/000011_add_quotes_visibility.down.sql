@@ -0,0 +1,3 @@
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_visibility_check;
+
+ALTER TABLE quotes DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,3 @@
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS visibility text NOT NULL DEFAULT 'public';
+
+ALTER TABLE quotes ADD CONSTRAINT quotes_visibility_check CHECK (visibility IN ('public', 'unlisted', 'private'));
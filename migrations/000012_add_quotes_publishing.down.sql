@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS quotes_scheduled_publish_at_idx;
+
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_publish_at_check;
+
+ALTER TABLE quotes DROP CONSTRAINT IF EXISTS quotes_status_check;
+
+ALTER TABLE quotes DROP COLUMN IF EXISTS publish_at;
+
+ALTER TABLE quotes DROP COLUMN IF EXISTS status;
@@ -0,0 +1,10 @@
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'published';
+
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS publish_at timestamp(0) with time zone;
+
+ALTER TABLE quotes ADD CONSTRAINT quotes_status_check CHECK (status IN ('draft', 'scheduled', 'published'));
+
+ALTER TABLE quotes ADD CONSTRAINT quotes_publish_at_check CHECK (status != 'scheduled' OR publish_at IS NOT NULL);
+
+-- used by the publish scheduler to find quotes that are due
+CREATE INDEX IF NOT EXISTS quotes_scheduled_publish_at_idx ON quotes (publish_at) WHERE status = 'scheduled';
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS daily_quotes (
+    day date NOT NULL,
+    timezone text NOT NULL,
+    quote_id bigint NOT NULL REFERENCES quotes ON DELETE CASCADE,
+    PRIMARY KEY (day, timezone)
+);
@@ -0,0 +1,7 @@
+DROP MATERIALIZED VIEW IF EXISTS quote_scores;
+
+DROP FUNCTION IF EXISTS wilson_lower_bound(double precision, double precision);
+
+DROP INDEX IF EXISTS likes_created_at_idx;
+
+ALTER TABLE likes DROP COLUMN IF EXISTS created_at;
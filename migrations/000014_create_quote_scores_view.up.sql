@@ -0,0 +1,43 @@
+ALTER TABLE likes ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+
+CREATE INDEX IF NOT EXISTS likes_created_at_idx ON likes (created_at);
+
+-- lower bound of the 95% Wilson score confidence interval for the proportion of positive votes
+CREATE OR REPLACE FUNCTION wilson_lower_bound(positive double precision, total double precision) RETURNS double precision AS $$
+    SELECT CASE WHEN total = 0 THEN 0 ELSE
+        ((positive + 1.9208) / total - 1.96 * sqrt(positive * (total - positive) / total + 0.9604) / total) / (1 + 3.8416 / total)
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+-- hot sums every like (+1) and dislike (-1) decayed by the age of the vote in hours with a gravity of 1.8,
+-- so old quotes can still trend when they are liked again. top_<window> is the Wilson lower bound of the
+-- votes cast within the window. Refreshed periodically by the API's scores scheduler.
+CREATE MATERIALIZED VIEW IF NOT EXISTS quote_scores AS
+SELECT
+    quotes.id AS quote_id,
+    COALESCE(sum(
+        (CASE WHEN likes.val = 1 THEN 1 WHEN likes.val = 0 THEN -1 END)
+        / power(extract(epoch FROM NOW() - likes.created_at) / 3600 + 2, 1.8)
+    ), 0) AS hot,
+    wilson_lower_bound(
+        count(*) FILTER (WHERE likes.val = 1 AND likes.created_at > NOW() - interval '1 day'),
+        count(*) FILTER (WHERE likes.val IN (0, 1) AND likes.created_at > NOW() - interval '1 day')
+    ) AS top_day,
+    wilson_lower_bound(
+        count(*) FILTER (WHERE likes.val = 1 AND likes.created_at > NOW() - interval '1 week'),
+        count(*) FILTER (WHERE likes.val IN (0, 1) AND likes.created_at > NOW() - interval '1 week')
+    ) AS top_week,
+    wilson_lower_bound(
+        count(*) FILTER (WHERE likes.val = 1 AND likes.created_at > NOW() - interval '1 month'),
+        count(*) FILTER (WHERE likes.val IN (0, 1) AND likes.created_at > NOW() - interval '1 month')
+    ) AS top_month,
+    wilson_lower_bound(
+        count(*) FILTER (WHERE likes.val = 1),
+        count(*) FILTER (WHERE likes.val IN (0, 1))
+    ) AS top_all
+FROM quotes
+LEFT JOIN likes ON likes.quote_id = quotes.id
+GROUP BY quotes.id;
+
+-- required to refresh the view concurrently
+CREATE UNIQUE INDEX IF NOT EXISTS quote_scores_quote_id_idx ON quote_scores (quote_id);
@@ -0,0 +1,7 @@
+ALTER TABLE likes DROP CONSTRAINT IF EXISTS likes_val_fkey;
+
+DELETE FROM likes WHERE val NOT IN (0, 1);
+
+ALTER TABLE likes ADD CONSTRAINT likes_val_check CHECK (val = 0 OR val = 1);
+
+DROP TABLE IF EXISTS reaction_types;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS reaction_types (
+    id smallint PRIMARY KEY,
+    name text UNIQUE NOT NULL
+);
+
+-- must match likeTypeNames in internal/data/likes.go
+INSERT INTO reaction_types (id, name)
+VALUES
+    (0, 'dislike'),
+    (1, 'like'),
+    (2, 'love'),
+    (3, 'insightful'),
+    (4, 'funny')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE likes DROP CONSTRAINT IF EXISTS likes_val_check;
+
+ALTER TABLE likes ADD CONSTRAINT likes_val_fkey FOREIGN KEY (val) REFERENCES reaction_types (id);
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS likes_reaction_counts_trigger ON likes;
+DROP FUNCTION IF EXISTS sync_reaction_counts();
+
+DROP TRIGGER IF EXISTS quotes_modified_trigger ON quotes;
+
+CREATE TRIGGER quotes_modified_trigger BEFORE UPDATE ON quotes
+    FOR EACH ROW EXECUTE PROCEDURE sync_last_modified();
+
+ALTER TABLE quotes DROP COLUMN IF EXISTS dislike_count;
+ALTER TABLE quotes DROP COLUMN IF EXISTS like_count;
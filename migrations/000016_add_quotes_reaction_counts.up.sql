@@ -0,0 +1,40 @@
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS like_count bigint NOT NULL DEFAULT 0;
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS dislike_count bigint NOT NULL DEFAULT 0;
+
+UPDATE quotes SET
+    like_count = (SELECT COUNT(*) FROM likes WHERE likes.quote_id = quotes.id AND likes.val = 1),
+    dislike_count = (SELECT COUNT(*) FROM likes WHERE likes.quote_id = quotes.id AND likes.val = 0);
+
+-- only edits made by the quote's owner should change last_modified, not the counters below
+DROP TRIGGER IF EXISTS quotes_modified_trigger ON quotes;
+
+CREATE TRIGGER quotes_modified_trigger
+    BEFORE UPDATE OF content, author, source_title, source_type, tags, visibility, status, publish_at ON quotes
+    FOR EACH ROW EXECUTE PROCEDURE sync_last_modified();
+
+-- keeps quotes.like_count and quotes.dislike_count in step with the likes table. The counters are
+-- changed relative to their current value so concurrent reactions to the same quote serialise on
+-- the quote's row lock instead of overwriting each other.
+CREATE OR REPLACE FUNCTION sync_reaction_counts() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE quotes SET
+            like_count = like_count - (OLD.val = 1)::int,
+            dislike_count = dislike_count - (OLD.val = 0)::int
+        WHERE id = OLD.quote_id AND OLD.val IN (0, 1);
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE quotes SET
+            like_count = like_count + (NEW.val = 1)::int,
+            dislike_count = dislike_count + (NEW.val = 0)::int
+        WHERE id = NEW.quote_id AND NEW.val IN (0, 1);
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER likes_reaction_counts_trigger
+    AFTER INSERT OR DELETE OR UPDATE OF val ON likes
+    FOR EACH ROW EXECUTE PROCEDURE sync_reaction_counts();
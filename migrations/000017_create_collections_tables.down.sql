@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS collection_quotes;
+
+DROP TABLE IF EXISTS collections;
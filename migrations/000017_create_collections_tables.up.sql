@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_modified timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    visibility text NOT NULL DEFAULT 'public',
+    version integer NOT NULL DEFAULT 1
+);
+
+ALTER TABLE collections ADD CONSTRAINT collections_name_check CHECK (LENGTH(name) BETWEEN 1 AND 100);
+
+ALTER TABLE collections ADD CONSTRAINT collections_description_check CHECK (LENGTH(description) < 500);
+
+ALTER TABLE collections ADD CONSTRAINT collections_visibility_check CHECK (visibility IN ('public', 'unlisted', 'private'));
+
+ALTER TABLE collections ADD CONSTRAINT collections_user_id_name_key UNIQUE (user_id, name);
+
+CREATE TRIGGER collections_modified_trigger BEFORE UPDATE OF name, description, visibility ON collections
+    FOR EACH ROW EXECUTE PROCEDURE sync_last_modified();
+
+-- position orders the quotes within a collection starting from 1. It isn't unique so that moving a
+-- quote can shift its neighbours one statement at a time.
+CREATE TABLE IF NOT EXISTS collection_quotes (
+    collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+    quote_id bigint NOT NULL REFERENCES quotes ON DELETE CASCADE,
+    position integer NOT NULL,
+    added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (collection_id, quote_id)
+);
+
+CREATE INDEX IF NOT EXISTS collection_quotes_position_idx ON collection_quotes (collection_id, position);
+
+CREATE INDEX IF NOT EXISTS collection_quotes_quote_id_idx ON collection_quotes (quote_id);
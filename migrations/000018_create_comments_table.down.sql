@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS comments;
+
+DROP FUNCTION IF EXISTS sync_comment_count();
+
+ALTER TABLE quotes DROP COLUMN IF EXISTS comment_count;
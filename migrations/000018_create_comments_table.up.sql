@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS comments (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_modified timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    quote_id bigint NOT NULL REFERENCES quotes ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    -- replies point at the top-level comment they answer, replies to replies aren't allowed
+    parent_id bigint REFERENCES comments ON DELETE CASCADE,
+    body text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+ALTER TABLE comments ADD CONSTRAINT comments_body_check CHECK (LENGTH(body) BETWEEN 1 AND 2000);
+
+CREATE INDEX IF NOT EXISTS comments_quote_id_idx ON comments (quote_id, created_at) WHERE parent_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments (parent_id, created_at);
+
+CREATE TRIGGER comments_modified_trigger BEFORE UPDATE OF body ON comments
+    FOR EACH ROW EXECUTE PROCEDURE sync_last_modified();
+
+ALTER TABLE quotes ADD COLUMN IF NOT EXISTS comment_count bigint NOT NULL DEFAULT 0;
+
+-- keeps quotes.comment_count in step with the comments table, counting replies as well
+CREATE OR REPLACE FUNCTION sync_comment_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE quotes SET comment_count = comment_count + 1 WHERE id = NEW.quote_id;
+    ELSE
+        UPDATE quotes SET comment_count = comment_count - 1 WHERE id = OLD.quote_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comments_count_trigger
+    AFTER INSERT OR DELETE ON comments
+    FOR EACH ROW EXECUTE PROCEDURE sync_comment_count();
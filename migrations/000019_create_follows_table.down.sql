@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS quotes_user_id_feed_idx;
+
+DROP TABLE IF EXISTS follows;
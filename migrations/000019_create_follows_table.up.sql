@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    followee_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followee_id)
+);
+
+ALTER TABLE follows ADD CONSTRAINT follows_self_check CHECK (follower_id != followee_id);
+
+CREATE INDEX IF NOT EXISTS follows_followee_id_idx ON follows (followee_id, created_at);
+
+-- the feed reads each followed user's most recent quotes from this index, see data.feedTime
+CREATE INDEX IF NOT EXISTS quotes_user_id_feed_idx ON quotes (user_id, (COALESCE(publish_at, created_at)) DESC, id DESC);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    -- the user being notified and the user whose action caused the notification
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    actor_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    type text NOT NULL,
+    quote_id bigint REFERENCES quotes ON DELETE CASCADE,
+    comment_id bigint REFERENCES comments ON DELETE CASCADE,
+    read_at timestamp(0) with time zone
+);
+
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check CHECK (type IN ('reaction', 'comment', 'reply', 'follow'));
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+-- a missing row means the notification type is enabled
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    type text NOT NULL,
+    enabled bool NOT NULL,
+    PRIMARY KEY (user_id, type)
+);
+
+ALTER TABLE notification_preferences ADD CONSTRAINT notification_preferences_type_check CHECK (type IN ('reaction', 'comment', 'reply', 'follow'));
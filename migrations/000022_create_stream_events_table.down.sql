@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS quotes_stream_trigger ON quotes;
+
+DROP FUNCTION IF EXISTS stream_quote_events();
+
+DROP FUNCTION IF EXISTS publish_stream_event(text, quotes, jsonb);
+
+DROP TABLE IF EXISTS stream_events;
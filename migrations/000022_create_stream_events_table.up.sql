@@ -0,0 +1,77 @@
+-- events shown on GET /v1/stream. They are only kept for a while (see the -stream-retention flag)
+-- so that clients can resume after reconnecting with Last-Event-ID.
+CREATE TABLE IF NOT EXISTS stream_events (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    type text NOT NULL,
+    quote_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    tags text[] NOT NULL,
+    data jsonb NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS stream_events_created_at_idx ON stream_events (created_at);
+
+-- records the event and tells every API instance listening on the stream_events channel about it
+CREATE OR REPLACE FUNCTION publish_stream_event(event_type text, quote quotes, event_data jsonb) RETURNS void AS $$
+DECLARE
+    event_id bigint;
+BEGIN
+    INSERT INTO stream_events (type, quote_id, user_id, tags, data)
+    VALUES (event_type, quote.id, quote.user_id, quote.tags, event_data)
+    RETURNING id INTO event_id;
+
+    PERFORM pg_notify('stream_events', json_build_object(
+        'id', event_id,
+        'type', event_type,
+        'quote_id', quote.id,
+        'user_id', quote.user_id,
+        'tags', quote.tags,
+        'data', event_data
+    )::text);
+END;
+$$ LANGUAGE plpgsql;
+
+-- only public published quotes are streamed. A quote that becomes listed is streamed as created
+-- and one that stops being listed as deleted, so clients can keep a live list in step.
+CREATE OR REPLACE FUNCTION stream_quote_events() RETURNS trigger AS $$
+DECLARE
+    old_listed bool := false;
+    new_listed bool := false;
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        old_listed := OLD.visibility = 'public' AND OLD.status = 'published';
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        new_listed := NEW.visibility = 'public' AND NEW.status = 'published';
+    END IF;
+
+    IF new_listed AND NOT old_listed THEN
+        PERFORM publish_stream_event('quote.created', NEW, jsonb_build_object(
+            'id', NEW.id,
+            'created_at', NEW.created_at,
+            'user_id', NEW.user_id,
+            'content', NEW.content,
+            'author', NEW.author,
+            'source', jsonb_build_object('title', NEW.source_title, 'type', NEW.source_type),
+            'tags', NEW.tags,
+            'likes', NEW.like_count,
+            'dislikes', NEW.dislike_count
+        ));
+    ELSIF old_listed AND NOT new_listed THEN
+        PERFORM publish_stream_event('quote.deleted', OLD, jsonb_build_object('id', OLD.id));
+    ELSIF new_listed AND (NEW.like_count, NEW.dislike_count) IS DISTINCT FROM (OLD.like_count, OLD.dislike_count) THEN
+        PERFORM publish_stream_event('quote.reacted', NEW, jsonb_build_object(
+            'id', NEW.id,
+            'likes', NEW.like_count,
+            'dislikes', NEW.dislike_count
+        ));
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER quotes_stream_trigger
+    AFTER INSERT OR DELETE OR UPDATE OF visibility, status, like_count, dislike_count ON quotes
+    FOR EACH ROW EXECUTE PROCEDURE stream_quote_events();
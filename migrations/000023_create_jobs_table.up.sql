@@ -0,0 +1,24 @@
+-- work that has to outlive the request that caused it. Jobs are claimed by the API's workers with
+-- FOR UPDATE SKIP LOCKED and deleted once they succeed. Jobs that run out of attempts are kept as
+-- dead for inspection.
+CREATE TABLE IF NOT EXISTS jobs (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    type text NOT NULL,
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL,
+    run_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    -- a running job whose lease has expired is assumed to have been abandoned by a dead worker
+    locked_until timestamp(0) with time zone,
+    last_error text NOT NULL DEFAULT ''
+);
+
+ALTER TABLE jobs ADD CONSTRAINT jobs_status_check CHECK (status IN ('pending', 'running', 'dead'));
+
+ALTER TABLE jobs ADD CONSTRAINT jobs_max_attempts_check CHECK (max_attempts >= 1);
+
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (run_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS jobs_locked_until_idx ON jobs (locked_until) WHERE status = 'running';
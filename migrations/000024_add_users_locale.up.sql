@@ -0,0 +1,4 @@
+-- the language emails are sent to the user in, as a lowercase language tag such as en or pt-br
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale text NOT NULL DEFAULT 'en';
+
+ALTER TABLE users ADD CONSTRAINT users_locale_check CHECK (locale ~ '^[a-z]{2,3}(-[a-z0-9]{2,8})*$');
@@ -0,0 +1,17 @@
+-- users without a row don't get digests. next_send_at is worked out by the API from the frequency
+-- and time zone, and is NULL while digests are turned off.
+CREATE TABLE IF NOT EXISTS digest_preferences (
+    user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    enabled bool NOT NULL DEFAULT false,
+    tags text[] NOT NULL DEFAULT '{}',
+    frequency text NOT NULL DEFAULT 'weekly',
+    timezone text NOT NULL DEFAULT 'UTC',
+    last_sent_at timestamp(0) with time zone,
+    next_send_at timestamp(0) with time zone
+);
+
+ALTER TABLE digest_preferences ADD CONSTRAINT digest_preferences_frequency_check CHECK (frequency IN ('daily', 'weekly'));
+
+ALTER TABLE digest_preferences ADD CONSTRAINT digest_preferences_tags_check CHECK (cardinality(tags) <= 10);
+
+CREATE INDEX IF NOT EXISTS digest_preferences_due_idx ON digest_preferences (next_send_at) WHERE enabled;
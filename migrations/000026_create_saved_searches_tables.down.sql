@@ -0,0 +1,11 @@
+DELETE FROM notification_preferences WHERE type = 'saved_search';
+ALTER TABLE notification_preferences DROP CONSTRAINT notification_preferences_type_check;
+ALTER TABLE notification_preferences ADD CONSTRAINT notification_preferences_type_check CHECK (type IN ('reaction', 'comment', 'reply', 'follow'));
+
+DELETE FROM notifications WHERE type = 'saved_search';
+ALTER TABLE notifications DROP CONSTRAINT notifications_type_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check CHECK (type IN ('reaction', 'comment', 'reply', 'follow'));
+
+DROP TABLE IF EXISTS saved_search_matches;
+
+DROP TABLE IF EXISTS saved_searches;
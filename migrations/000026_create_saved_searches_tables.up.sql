@@ -0,0 +1,43 @@
+-- the content, author and tags criteria of GET /v1/quotes, empty values match every quote
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    name text NOT NULL,
+    content text NOT NULL DEFAULT '',
+    author text NOT NULL DEFAULT '',
+    tags text[] NOT NULL DEFAULT '{}',
+    -- how the user is told about new matches: in_app, email or none
+    alert text NOT NULL DEFAULT 'in_app'
+);
+
+ALTER TABLE saved_searches ADD CONSTRAINT saved_searches_name_check CHECK (LENGTH(name) BETWEEN 1 AND 100);
+
+ALTER TABLE saved_searches ADD CONSTRAINT saved_searches_content_check CHECK (LENGTH(content) < 300);
+
+ALTER TABLE saved_searches ADD CONSTRAINT saved_searches_author_check CHECK (LENGTH(author) < 100);
+
+ALTER TABLE saved_searches ADD CONSTRAINT saved_searches_tags_check CHECK (cardinality(tags) <= 10);
+
+ALTER TABLE saved_searches ADD CONSTRAINT saved_searches_alert_check CHECK (alert IN ('in_app', 'email', 'none'));
+
+ALTER TABLE saved_searches ADD CONSTRAINT saved_searches_user_id_name_key UNIQUE (user_id, name);
+
+-- new quotes are matched by looking up the searches whose tags they contain
+CREATE INDEX IF NOT EXISTS saved_searches_tags_idx ON saved_searches USING GIN (tags);
+
+-- every quote a search has alerted its owner about, so that nobody is alerted twice
+CREATE TABLE IF NOT EXISTS saved_search_matches (
+    saved_search_id bigint NOT NULL REFERENCES saved_searches ON DELETE CASCADE,
+    quote_id bigint NOT NULL REFERENCES quotes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (saved_search_id, quote_id)
+);
+
+CREATE INDEX IF NOT EXISTS saved_search_matches_quote_id_idx ON saved_search_matches (quote_id);
+
+ALTER TABLE notifications DROP CONSTRAINT notifications_type_check;
+ALTER TABLE notifications ADD CONSTRAINT notifications_type_check CHECK (type IN ('reaction', 'comment', 'reply', 'follow', 'saved_search'));
+
+ALTER TABLE notification_preferences DROP CONSTRAINT notification_preferences_type_check;
+ALTER TABLE notification_preferences ADD CONSTRAINT notification_preferences_type_check CHECK (type IN ('reaction', 'comment', 'reply', 'follow', 'saved_search'));
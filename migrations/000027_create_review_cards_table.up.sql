@@ -0,0 +1,18 @@
+-- a quote the user is memorising and its SM-2 schedule. New cards are due straight away.
+CREATE TABLE IF NOT EXISTS review_cards (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    quote_id bigint NOT NULL REFERENCES quotes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ease_factor float8 NOT NULL DEFAULT 2.5,
+    interval_days integer NOT NULL DEFAULT 0,
+    repetitions integer NOT NULL DEFAULT 0,
+    due_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_reviewed_at timestamp(0) with time zone,
+    PRIMARY KEY (user_id, quote_id)
+);
+
+ALTER TABLE review_cards ADD CONSTRAINT review_cards_ease_factor_check CHECK (ease_factor >= 1.3);
+
+ALTER TABLE review_cards ADD CONSTRAINT review_cards_interval_days_check CHECK (interval_days >= 0);
+
+CREATE INDEX IF NOT EXISTS review_cards_due_idx ON review_cards (user_id, due_at);
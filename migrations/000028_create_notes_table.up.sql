@@ -0,0 +1,18 @@
+-- a user's private note on a quote, anyone's quote can be annotated
+CREATE TABLE IF NOT EXISTS notes (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    quote_id bigint NOT NULL REFERENCES quotes ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_modified timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    body text NOT NULL,
+    PRIMARY KEY (user_id, quote_id)
+);
+
+ALTER TABLE notes ADD CONSTRAINT notes_body_check CHECK (LENGTH(body) BETWEEN 1 AND 5000);
+
+CREATE INDEX IF NOT EXISTS notes_user_id_idx ON notes (user_id, last_modified DESC);
+
+CREATE INDEX IF NOT EXISTS notes_body_idx ON notes USING GIN (to_tsvector('english', body));
+
+CREATE TRIGGER notes_modified_trigger BEFORE UPDATE OF body ON notes
+    FOR EACH ROW EXECUTE PROCEDURE sync_last_modified();
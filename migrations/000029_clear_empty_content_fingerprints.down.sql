@@ -0,0 +1 @@
+UPDATE quotes SET content_fingerprint = md5('') WHERE content_fingerprint = '';
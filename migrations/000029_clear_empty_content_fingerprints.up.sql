@@ -0,0 +1,2 @@
+-- content without any letters or digits has no fingerprint, migration 000010 gave it md5('')
+UPDATE quotes SET content_fingerprint = '' WHERE content_fingerprint = md5('');
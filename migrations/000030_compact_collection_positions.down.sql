@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS collection_quotes_compact_trigger ON collection_quotes;
+DROP FUNCTION IF EXISTS compact_collection_positions();
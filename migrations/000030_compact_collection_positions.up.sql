@@ -0,0 +1,37 @@
+-- renumbers the collections that lost quotes so their positions run from 1 without gaps, however
+-- the quotes were removed. Deleting a quote cascades to every collection it was in, so this can't
+-- be left to the API.
+CREATE OR REPLACE FUNCTION compact_collection_positions() RETURNS trigger AS $$
+BEGIN
+    UPDATE collection_quotes
+    SET position = renumbered.position
+    FROM (
+        SELECT collection_id, quote_id,
+            row_number() OVER (PARTITION BY collection_id ORDER BY position, quote_id) AS position
+        FROM collection_quotes
+        WHERE collection_id IN (SELECT DISTINCT collection_id FROM removed)
+    ) AS renumbered
+    WHERE collection_quotes.collection_id = renumbered.collection_id
+    AND collection_quotes.quote_id = renumbered.quote_id
+    AND collection_quotes.position != renumbered.position;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER collection_quotes_compact_trigger
+    AFTER DELETE ON collection_quotes
+    REFERENCING OLD TABLE AS removed
+    FOR EACH STATEMENT EXECUTE PROCEDURE compact_collection_positions();
+
+-- close the gaps left by quotes that were deleted before the trigger existed
+UPDATE collection_quotes
+SET position = renumbered.position
+FROM (
+    SELECT collection_id, quote_id,
+        row_number() OVER (PARTITION BY collection_id ORDER BY position, quote_id) AS position
+    FROM collection_quotes
+) AS renumbered
+WHERE collection_quotes.collection_id = renumbered.collection_id
+AND collection_quotes.quote_id = renumbered.quote_id
+AND collection_quotes.position != renumbered.position;